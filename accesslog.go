@@ -0,0 +1,292 @@
+package grpc_server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// AccessLog logs a structured record for each request served by a gRPC server.
+//
+// Create it with NewAccessLog and pass it to the server with WithAccessLog.
+type AccessLog struct {
+	logger          Logger
+	levels          map[codes.Code]Level
+	sampleRates     map[string]float64
+	excluded        map[string]bool
+	requestIDHeader string
+}
+
+// AccessLogOption configures the access log created by NewAccessLog.
+type AccessLogOption func(*accessLogConfig) error
+
+type accessLogConfig struct {
+	logger          Logger
+	levels          map[codes.Code]Level
+	sampleRates     map[string]float64
+	excluded        []string
+	requestIDHeader string
+}
+
+func defaultAccessLogConfig() *accessLogConfig {
+	return &accessLogConfig{
+		levels:          make(map[codes.Code]Level),
+		sampleRates:     make(map[string]float64),
+		requestIDHeader: "x-request-id",
+	}
+}
+
+// WithAccessLogLogger sets the logger the records are written to.
+// By default, records are written to the logger of the request, as returned by LoggerFromContext.
+func WithAccessLogLogger(logger Logger) AccessLogOption {
+	return func(c *accessLogConfig) error {
+		if logger == nil {
+			return errors.New("access log logger must not be nil")
+		}
+		c.logger = logger
+		return nil
+	}
+}
+
+// WithAccessLogLevel sets the level of the records of requests that return the given status codes.
+//
+// By default, successful requests are logged at info level,
+// server errors like Internal and Unavailable at error level,
+// and the other errors at warning level.
+func WithAccessLogLevel(level Level, statusCodes ...codes.Code) AccessLogOption {
+	return func(c *accessLogConfig) error {
+		if level < LevelDebug || level > LevelError {
+			return fmt.Errorf("invalid access log level %d", level)
+		}
+		if len(statusCodes) == 0 {
+			return errors.New("access log level requires at least one status code")
+		}
+		for _, code := range statusCodes {
+			c.levels[code] = level
+		}
+		return nil
+	}
+}
+
+// WithAccessLogSampleRate sets the rate at which the successful requests of the given methods are logged,
+// between 0 and 1, e.g. 0.01 to log one request out of a hundred.
+// Failed requests are always logged.
+func WithAccessLogSampleRate(rate float64, methods ...string) AccessLogOption {
+	return func(c *accessLogConfig) error {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid access log sample rate %v", rate)
+		}
+		if len(methods) == 0 {
+			return errors.New("access log sample rate requires at least one method")
+		}
+		for _, method := range methods {
+			c.sampleRates[method] = rate
+		}
+		return nil
+	}
+}
+
+// WithAccessLogExcludedMethods excludes the given methods from the access log,
+// e.g. the health check method.
+func WithAccessLogExcludedMethods(methods ...string) AccessLogOption {
+	return func(c *accessLogConfig) error {
+		c.excluded = append(c.excluded, methods...)
+		return nil
+	}
+}
+
+// WithAccessLogRequestIDHeader sets the metadata key of the request ID.
+// The default is x-request-id.
+func WithAccessLogRequestIDHeader(header string) AccessLogOption {
+	return func(c *accessLogConfig) error {
+		if header == "" {
+			return errors.New("access log request ID header must not be empty")
+		}
+		c.requestIDHeader = header
+		return nil
+	}
+}
+
+// NewAccessLog creates the access log of a gRPC server.
+// It returns an error if an option is invalid.
+func NewAccessLog(opts ...AccessLogOption) (*AccessLog, error) {
+	config := defaultAccessLogConfig()
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	return &AccessLog{
+		logger:          config.logger,
+		levels:          config.levels,
+		sampleRates:     config.sampleRates,
+		excluded:        ignoredEndpointSet(config.excluded),
+		requestIDHeader: config.requestIDHeader,
+	}, nil
+}
+
+// WithAccessLog makes the server log a record for each request in the given access log.
+//
+// The access log interceptors are registered after the metrics interceptors
+// and before the other interceptors, so that they log the status returned to clients.
+func WithAccessLog(accessLog *AccessLog) Option {
+	return func(c *serverConfig) error {
+		if accessLog == nil {
+			return errors.New("access log must not be nil")
+		}
+		c.accessLog = accessLog
+		return nil
+	}
+}
+
+// UnaryInterceptor returns an interceptor that logs a record for each request.
+//
+// Records have the method, the RPC type, the status code, the duration in milliseconds,
+// the address of the client, the size of the request and of the response in bytes,
+// the request ID taken from the metadata and the client identity, if any.
+//
+// Servers created with WithAccessLog register it automatically.
+func (a *AccessLog) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		if a.excluded[info.FullMethod] {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		resp, err = handler(ctx, req)
+
+		a.log(ctx, newRPCInfo(info.FullMethod, unaryRPC), time.Since(start), err, func(fields Fields) {
+			sizes := messageSizesFromContext(ctx)
+			if size := sizes.requestSize(req); size >= 0 {
+				fields["request_size"] = size
+			}
+			if err == nil {
+				if size := sizes.responseSize(resp); size >= 0 {
+					fields["response_size"] = size
+				}
+			}
+		})
+
+		return resp, err
+	}
+}
+
+// StreamInterceptor returns the stream counterpart of UnaryInterceptor.
+//
+// Stream records have the number of messages received and sent,
+// and their total size as the request and response size.
+func (a *AccessLog) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if a.excluded[info.FullMethod] {
+			return handler(srv, ss)
+		}
+
+		rpc := newRPCInfo(info.FullMethod, streamRPCType(info))
+
+		// the messages are already counted when the metrics interceptor comes first
+		stream, ok := countingServerStreamFromContext(ss.Context())
+		if !ok {
+			stream = newCountingServerStream(ss, rpc, nil)
+			ss = stream
+		}
+
+		start := time.Now()
+		err := handler(srv, ss)
+
+		a.log(ss.Context(), rpc, time.Since(start), err, func(fields Fields) {
+			fields["messages_received"] = atomic.LoadInt64(&stream.received)
+			fields["messages_sent"] = atomic.LoadInt64(&stream.sent)
+			fields["request_size"] = atomic.LoadInt64(&stream.receivedBytes)
+			fields["response_size"] = atomic.LoadInt64(&stream.sentBytes)
+		})
+
+		return err
+	}
+}
+
+func (a *AccessLog) log(
+	ctx context.Context,
+	rpc RPCInfo,
+	duration time.Duration,
+	err error,
+	sizes func(fields Fields),
+) {
+	code := status.Code(err)
+
+	logger := a.logger
+	if logger == nil {
+		logger = LoggerFromContext(ctx)
+	}
+
+	level := a.level(code)
+	if !logger.Enabled(ctx, level) || !a.sampled(rpc.FullMethod, code) {
+		return
+	}
+
+	fields := Fields{
+		"grpc.method": rpc.FullMethod,
+		"grpc.type":   rpc.Type,
+		"grpc.code":   code.String(),
+		"duration_ms": float64(duration) / float64(time.Millisecond),
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		fields["peer.address"] = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if requestID := metadataCarrier(md).Get(a.requestIDHeader); requestID != "" {
+		fields["request_id"] = requestID
+	}
+	if id, ok := peerIdentityID(ctx); ok {
+		fields["user"] = id
+	}
+	if err != nil {
+		fields["error"] = err
+	}
+	sizes(fields)
+
+	logger.Log(ctx, level, fmt.Sprintf("handled %s with code %s", rpc.FullMethod, code), fields)
+}
+
+func (a *AccessLog) level(code codes.Code) Level {
+	if level, ok := a.levels[code]; ok {
+		return level
+	}
+
+	switch {
+	case code == codes.OK:
+		return LevelInfo
+	case isServerError(code):
+		return LevelError
+	default:
+		return LevelWarn
+	}
+}
+
+// sampled reports whether a request is logged, according to the sample rate of its method.
+func (a *AccessLog) sampled(fullMethod string, code codes.Code) bool {
+	rate, ok := a.sampleRates[fullMethod]
+	if !ok || code != codes.OK {
+		return true
+	}
+	return rate > 0 && rand.Float64() < rate
+}
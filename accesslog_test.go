@@ -0,0 +1,287 @@
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestAccessLog(t *testing.T, opts ...AccessLogOption) (*AccessLog, *test.Hook) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(log.DebugLevel)
+
+	accessLog, err := NewAccessLog(append([]AccessLogOption{WithAccessLogLogger(NewLogrusLogger(logger))}, opts...)...)
+	assert.Nil(t, err)
+
+	return accessLog, hook
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Run("logs a record for each request", func(t *testing.T) {
+		accessLog, hook := newTestAccessLog(t)
+
+		client, mockServer, cleanup := setupTestServer(t, accessLog.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-request-id", "abc")
+		_, err := client.Endpoint(ctx, &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		entries := hook.AllEntries()
+		if !assert.Len(t, entries, 1) {
+			return
+		}
+		entry := entries[0]
+
+		assert.Equal(t, log.InfoLevel, entry.Level)
+		assert.Equal(t, "handled /internal.TestService/Endpoint with code OK", entry.Message)
+		assert.Equal(t, "/internal.TestService/Endpoint", entry.Data["grpc.method"])
+		assert.Equal(t, "unary", entry.Data["grpc.type"])
+		assert.Equal(t, "OK", entry.Data["grpc.code"])
+		assert.Equal(t, "abc", entry.Data["request_id"])
+		assert.Equal(t, "bufconn", entry.Data["peer.address"])
+		assert.Equal(t, 7, entry.Data["request_size"])
+		assert.Equal(t, 7, entry.Data["response_size"])
+		assert.IsType(t, float64(0), entry.Data["duration_ms"])
+		assert.NotContains(t, entry.Data, "user")
+		assert.NotContains(t, entry.Data, log.ErrorKey)
+	})
+
+	t.Run("logs the client identity", func(t *testing.T) {
+		accessLog, hook := newTestAccessLog(t)
+
+		ctx := context.WithValue(context.Background(), peerIdentityKey{}, &PeerIdentity{
+			SPIFFEID:   "spiffe://example.org/payments",
+			CommonName: "payments",
+		})
+		_, err := accessLog.UnaryInterceptor()(ctx, &internal.Input{Value: "Hello"}, &grpc.UnaryServerInfo{
+			FullMethod: "/internal.TestService/Endpoint",
+		}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return &internal.Output{Value: "World"}, nil
+		})
+		assert.Nil(t, err)
+
+		if assert.Len(t, hook.AllEntries(), 1) {
+			assert.Equal(t, "spiffe://example.org/payments", hook.LastEntry().Data["user"])
+		}
+	})
+
+	t.Run("logs errors at the level of their status code", func(t *testing.T) {
+		accessLog, hook := newTestAccessLog(t, WithAccessLogLevel(LevelDebug, codes.Canceled))
+
+		client, mockServer, cleanup := setupTestServer(t, accessLog.UnaryInterceptor())
+		defer cleanup()
+
+		for _, testCase := range []struct {
+			err   error
+			level log.Level
+		}{
+			{status.Error(codes.NotFound, "not found"), log.WarnLevel},
+			{status.Error(codes.Unavailable, "database is down"), log.ErrorLevel},
+			{fmt.Errorf("random error"), log.ErrorLevel},
+			{status.Error(codes.Canceled, "canceled"), log.DebugLevel},
+		} {
+			hook.Reset()
+			mockServer.ExpectedCalls = nil
+			mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, testCase.err)
+
+			_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+			assert.NotNil(t, err)
+
+			if assert.Len(t, hook.AllEntries(), 1) {
+				entry := hook.LastEntry()
+				assert.Equal(t, testCase.level, entry.Level)
+				assert.Equal(t, testCase.err, entry.Data[log.ErrorKey])
+				assert.NotContains(t, entry.Data, "response_size")
+			}
+		}
+	})
+
+	t.Run("skips records below the level of the logger", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		logger.SetLevel(log.WarnLevel)
+
+		accessLog, err := NewAccessLog(WithAccessLogLogger(NewLogrusLogger(logger)))
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, accessLog.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+		assert.Empty(t, hook.AllEntries())
+	})
+
+	t.Run("skips excluded methods", func(t *testing.T) {
+		accessLog, hook := newTestAccessLog(t, WithAccessLogExcludedMethods("/internal.TestService/Endpoint"))
+
+		client, mockServer, cleanup := setupTestServer(t, accessLog.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("random error"))
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.NotNil(t, err)
+		assert.Empty(t, hook.AllEntries())
+	})
+
+	t.Run("samples the successful requests of a method", func(t *testing.T) {
+		accessLog, hook := newTestAccessLog(t, WithAccessLogSampleRate(0, "/internal.TestService/Endpoint"))
+
+		client, mockServer, cleanup := setupTestServer(t, accessLog.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil).Once()
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("random error")).Once()
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+		assert.Empty(t, hook.AllEntries())
+
+		// failed requests are always logged
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.NotNil(t, err)
+		assert.Len(t, hook.AllEntries(), 1)
+	})
+
+	t.Run("logs the messages of streams", func(t *testing.T) {
+		accessLog, hook := newTestAccessLog(t)
+
+		client, mockServer, cleanup := setupTestServerWithOptions(t, grpc.StreamInterceptor(accessLog.StreamInterceptor()))
+		defer cleanup()
+
+		mockServer.On("Stream", mock.Anything).Run(func(args mock.Arguments) {
+			stream := args.Get(0).(internal.TestService_StreamServer)
+			for {
+				input, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				_ = stream.Send(&internal.Output{Value: input.Value})
+			}
+		}).Return(nil)
+
+		stream, err := client.Stream(context.Background())
+		assert.Nil(t, err)
+		for _, value := range []string{"a", "b"} {
+			err = stream.Send(&internal.Input{Value: value})
+			assert.Nil(t, err)
+			_, err = stream.Recv()
+			assert.Nil(t, err)
+		}
+		err = stream.CloseSend()
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+
+		assert.Eventually(t, func() bool {
+			return len(hook.AllEntries()) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		entry := hook.LastEntry()
+		assert.Equal(t, "bidi_stream", entry.Data["grpc.type"])
+		assert.Equal(t, int64(2), entry.Data["messages_received"])
+		assert.Equal(t, int64(2), entry.Data["messages_sent"])
+		assert.Equal(t, int64(6), entry.Data["request_size"])
+		assert.Equal(t, int64(6), entry.Data["response_size"])
+	})
+
+	t.Run("reuses the message counts of the metrics", func(t *testing.T) {
+		accessLog, hook := newTestAccessLog(t)
+
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		mockServer, cc, cleanup := startTestServer(t, WithMetrics(metrics), WithAccessLog(accessLog))
+		defer cleanup()
+
+		mockServer.On("Stream", mock.Anything).Run(func(args mock.Arguments) {
+			stream := args.Get(0).(internal.TestService_StreamServer)
+
+			// the access log does not wrap the stream counted by the metrics
+			counting, ok := countingServerStreamFromContext(stream.Context())
+			assert.True(t, ok)
+			assert.NotNil(t, counting.recorder)
+
+			input, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			_ = stream.Send(&internal.Output{Value: input.Value})
+		}).Return(nil)
+
+		stream, err := internal.NewTestServiceClient(cc).Stream(context.Background())
+		assert.Nil(t, err)
+		err = stream.Send(&internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+
+		assert.Eventually(t, func() bool {
+			return len(hook.AllEntries()) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		entry := hook.LastEntry()
+		assert.Equal(t, int64(1), entry.Data["messages_received"])
+		assert.Equal(t, int64(1), entry.Data["messages_sent"])
+		assert.Equal(t, int64(7), entry.Data["request_size"])
+		assert.Equal(t, int64(7), entry.Data["response_size"])
+	})
+
+	t.Run("is registered by the server", func(t *testing.T) {
+		accessLog, hook := newTestAccessLog(t)
+
+		mockServer, cc, cleanup := startTestServer(t, WithAccessLog(accessLog))
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err := internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		if assert.Len(t, hook.AllEntries(), 1) {
+			assert.Contains(t, hook.LastEntry().Data["peer.address"], "127.0.0.1:")
+		}
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := NewAccessLog(WithAccessLogLogger(nil))
+		assert.NotNil(t, err)
+
+		_, err = NewAccessLog(WithAccessLogLevel(Level(10), codes.OK))
+		assert.NotNil(t, err)
+
+		_, err = NewAccessLog(WithAccessLogLevel(LevelInfo))
+		assert.NotNil(t, err)
+
+		_, err = NewAccessLog(WithAccessLogSampleRate(-1, "/internal.TestService/Endpoint"))
+		assert.NotNil(t, err)
+
+		_, err = NewAccessLog(WithAccessLogSampleRate(0.5))
+		assert.NotNil(t, err)
+
+		_, err = NewAccessLog(WithAccessLogRequestIDHeader(""))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithAccessLog(nil))
+		assert.NotNil(t, err)
+	})
+}
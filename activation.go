@@ -0,0 +1,71 @@
+package grpc_server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFdsStart is the first file descriptor passed by systemd with socket activation.
+var listenFdsStart = 3
+
+// WithSocketActivation makes the server accept connections on a socket
+// passed by systemd with socket activation, instead of binding a new one.
+//
+// The name selects the socket by its FileDescriptorName, as listed in LISTEN_FDNAMES.
+// An empty name selects the first socket.
+// If the process was not started with socket activation, or no socket matches the name,
+// the server binds the configured address or port.
+func WithSocketActivation(name string) Option {
+	return func(c *serverConfig) error {
+		if strings.Contains(name, ":") {
+			return fmt.Errorf("invalid socket name %q", name)
+		}
+		c.socketActivation = true
+		c.socketActivationName = name
+		return nil
+	}
+}
+
+// activatedListener returns the listener passed by systemd with the given name,
+// or nil if the process was not started with socket activation
+// or no socket matches the name.
+//
+// The environment variables are not unset: they only apply to the process
+// whose PID matches LISTEN_PID, so child processes ignore them.
+func activatedListener(name string) (net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	var names []string
+	if fdNames := os.Getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	for i := 0; i < count; i++ {
+		if name != "" && (i >= len(names) || names[i] != name) {
+			continue
+		}
+
+		file := os.NewFile(uintptr(listenFdsStart+i), fmt.Sprintf("LISTEN_FD_%d", listenFdsStart+i))
+		// the listener uses a duplicate of the file descriptor
+		defer file.Close()
+
+		activated, err := net.FileListener(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to use socket activation file descriptor %d: %w", listenFdsStart+i, err)
+		}
+		return activated, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,107 @@
+//go:build unix
+
+package grpc_server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// activateSocket passes a new TCP socket to the current process,
+// as systemd would with socket activation, and returns its address.
+func activateSocket(t *testing.T, names string) net.Addr {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer tcpListener.Close()
+
+	file, err := tcpListener.(*net.TCPListener).File()
+	assert.Nil(t, err)
+	defer file.Close()
+
+	// the server takes ownership of the activated file descriptor
+	fd, err := syscall.Dup(int(file.Fd()))
+	assert.Nil(t, err)
+
+	previousStart := listenFdsStart
+	listenFdsStart = fd
+	t.Cleanup(func() {
+		listenFdsStart = previousStart
+	})
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", names)
+
+	return tcpListener.Addr()
+}
+
+func TestSocketActivation(t *testing.T) {
+	t.Run("listens on the activated socket", func(t *testing.T) {
+		addr := activateSocket(t, "grpc")
+
+		server, err := NewServer(WithSocketActivation(""), WithAddress("tcp", "127.0.0.1:0"))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		assert.Equal(t, addr.String(), server.Addr().String())
+
+		err = checkHealth(addr.String(), insecure.NewCredentials())
+		assert.Nil(t, err)
+	})
+
+	t.Run("selects the socket by name", func(t *testing.T) {
+		addr := activateSocket(t, "grpc")
+
+		server, err := NewServer(WithSocketActivation("grpc"), WithAddress("tcp", "127.0.0.1:0"))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		assert.Equal(t, addr.String(), server.Addr().String())
+	})
+
+	t.Run("binds the configured address when no socket matches the name", func(t *testing.T) {
+		addr := activateSocket(t, "http")
+		defer syscall.Close(listenFdsStart)
+
+		server, err := NewServer(WithSocketActivation("grpc"), WithAddress("tcp", "127.0.0.1:0"))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		assert.NotEqual(t, addr.String(), server.Addr().String())
+	})
+
+	t.Run("ignores sockets passed to another process", func(t *testing.T) {
+		addr := activateSocket(t, "grpc")
+		defer syscall.Close(listenFdsStart)
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+
+		server, err := NewServer(WithSocketActivation(""), WithAddress("tcp", "127.0.0.1:0"))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		assert.NotEqual(t, addr.String(), server.Addr().String())
+	})
+
+	t.Run("rejects invalid names", func(t *testing.T) {
+		_, err := NewServer(WithSocketActivation("a:b"))
+		assert.NotNil(t, err)
+	})
+}
@@ -2,10 +2,13 @@ package grpc_server
 
 import (
 	"context"
+	"io"
 	"net"
 	"testing"
 
 	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -20,7 +23,29 @@ func setupTestServer(
 	mockServer *internal.MockTestServiceServer,
 	cleanup func(),
 ) {
-	server := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+	return setupTestServerWithOptions(t, grpc.ChainUnaryInterceptor(interceptors...))
+}
+
+func setupTestStreamServer(
+	t *testing.T,
+	interceptors ...grpc.StreamServerInterceptor,
+) (
+	client internal.TestServiceClient,
+	mockServer *internal.MockTestServiceServer,
+	cleanup func(),
+) {
+	return setupTestServerWithOptions(t, grpc.ChainStreamInterceptor(interceptors...))
+}
+
+func setupTestServerWithOptions(
+	t *testing.T,
+	opts ...grpc.ServerOption,
+) (
+	client internal.TestServiceClient,
+	mockServer *internal.MockTestServiceServer,
+	cleanup func(),
+) {
+	server := grpc.NewServer(opts...)
 	listener := bufconn.Listen(1024 * 1024)
 	cc, err := grpc.DialContext(
 		context.Background(),
@@ -51,3 +76,67 @@ func setupTestServer(
 
 	return client, mockServer, cleanup
 }
+
+// echoStream answers every message received on the stream
+// with a message containing the same value.
+func echoStream(stream internal.TestService_StreamServer) error {
+	for {
+		in, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = stream.Send(&internal.Output{Value: in.Value})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// metricValue returns the value of the metric with the given name and labels,
+// or the sample count if the metric is a histogram.
+func metricValue(t *testing.T, collectors []prometheus.Collector, name string, labels prometheus.Labels) float64 {
+	metric := findMetric(t, collectors, name, labels)
+
+	switch {
+	case metric.GetCounter() != nil:
+		return metric.GetCounter().GetValue()
+	case metric.GetGauge() != nil:
+		return metric.GetGauge().GetValue()
+	case metric.GetHistogram() != nil:
+		return float64(metric.GetHistogram().GetSampleCount())
+	}
+	return 0
+}
+
+// findMetric returns the first metric with the given name, matching the given labels,
+// or nil if it is not found.
+func findMetric(t *testing.T, collectors []prometheus.Collector, name string, labels prometheus.Labels) *dto.Metric {
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collectors...)
+
+	families, err := registry.Gather()
+	assert.Nil(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value != label.GetValue() {
+					continue metrics
+				}
+			}
+			return metric
+		}
+	}
+
+	t.Errorf("metric %s with labels %v not found", name, labels)
+	return nil
+}
@@ -0,0 +1,65 @@
+package grpc_server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+)
+
+// bind creates a listener on the given network and address.
+// For Unix sockets, it removes stale socket files and applies the socket mode.
+func bind(network, address string, socketMode os.FileMode) (net.Listener, error) {
+	if network != "unix" {
+		return net.Listen(network, address)
+	}
+
+	// abstract sockets have no file on disk
+	abstract := address[0] == '@'
+
+	if !abstract {
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+	}
+
+	unixListener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if socketMode != 0 && !abstract {
+		if err := os.Chmod(address, socketMode); err != nil {
+			unixListener.Close()
+			return nil, fmt.Errorf("failed to set socket mode: %w", err)
+		}
+	}
+
+	return unixListener, nil
+}
+
+// removeStaleSocket removes a socket file left by a process that did not
+// shut down cleanly. It fails if the file is not a socket, or if another
+// process is still accepting connections on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("socket %s is in use", path)
+	}
+
+	return os.Remove(path)
+}
@@ -0,0 +1,185 @@
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// WithConcurrencyLimit limits the number of requests the server handles concurrently.
+// Requests over the limit wait until a running request completes,
+// or fail when their context is done.
+//
+// Requests to the health service are never limited.
+// When the server has metrics, the time spent waiting is recorded in the queue wait histogram,
+// and is not part of the request latency. Waiting requests are not counted in flight.
+func WithConcurrencyLimit(limit int) Option {
+	return func(c *serverConfig) error {
+		if limit <= 0 {
+			return fmt.Errorf("invalid concurrency limit %d", limit)
+		}
+		c.concurrencyLimit = limit
+		return nil
+	}
+}
+
+// concurrencyMetrics track the requests in flight.
+type concurrencyMetrics struct {
+	inFlight     *prometheus.GaugeVec
+	inFlightPeak *peakGauge
+	queueWait    *prometheus.HistogramVec
+}
+
+func newConcurrencyMetrics(config *metricsConfig, subsystem string, prefix string, labels []string) concurrencyMetrics {
+	return concurrencyMetrics{
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   config.namespace,
+			Subsystem:   subsystem,
+			Name:        prefix + "in_flight",
+			Help:        "Number of gRPC requests in flight",
+			ConstLabels: config.constLabels,
+		}, labels),
+		inFlightPeak: newPeakGauge(prometheus.NewDesc(
+			prometheus.BuildFQName(config.namespace, subsystem, prefix+"in_flight_peak"),
+			"Highest number of gRPC requests in flight on the server since it started",
+			nil,
+			config.constLabels,
+		)),
+		queueWait: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   config.namespace,
+			Subsystem:   subsystem,
+			Name:        prefix + "queue_wait_seconds",
+			Help:        "Time spent by gRPC requests waiting for the concurrency limit, in seconds",
+			Buckets:     defaultLatencyBuckets,
+			ConstLabels: config.constLabels,
+		}, labels),
+	}
+}
+
+func (c *concurrencyMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.inFlight, c.inFlightPeak, c.queueWait}
+}
+
+// peakGauge tracks the number of requests in flight on the whole server,
+// and exposes the highest value ever reached.
+// The value does not depend on collections, so that every scraper sees the same peak.
+type peakGauge struct {
+	desc *prometheus.Desc
+
+	mu      sync.Mutex
+	current int64
+	peak    int64
+}
+
+func newPeakGauge(desc *prometheus.Desc) *peakGauge {
+	return &peakGauge{desc: desc}
+}
+
+func (p *peakGauge) inc() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current++
+	if p.current > p.peak {
+		p.peak = p.current
+	}
+}
+
+func (p *peakGauge) dec() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current--
+}
+
+func (p *peakGauge) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.desc
+}
+
+func (p *peakGauge) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	peak := p.peak
+	p.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(p.desc, prometheus.GaugeValue, float64(peak))
+}
+
+// concurrencyLimiter makes requests over the limit wait for a running request to complete.
+type concurrencyLimiter struct {
+	slots   chan struct{}
+	metrics *Metrics
+}
+
+func newConcurrencyLimiter(limit int, metrics *Metrics) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		slots:   make(chan struct{}, limit),
+		metrics: metrics,
+	}
+}
+
+func (c *concurrencyLimiter) unary(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	if isHealthMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	if err := c.acquire(ctx, newRPCInfo(info.FullMethod, unaryRPC)); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	return handler(ctx, req)
+}
+
+func (c *concurrencyLimiter) stream(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if isHealthMethod(info.FullMethod) {
+		return handler(srv, ss)
+	}
+
+	if err := c.acquire(ss.Context(), newRPCInfo(info.FullMethod, streamRPCType(info))); err != nil {
+		return err
+	}
+	defer c.release()
+
+	return handler(srv, ss)
+}
+
+func (c *concurrencyLimiter) acquire(ctx context.Context, rpc RPCInfo) error {
+	start := time.Now()
+
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+
+	if c.metrics != nil && !c.metrics.ignoredEndpoints[rpc.FullMethod] {
+		c.metrics.recorder.QueueWait(ctx, rpc, time.Since(start))
+	}
+
+	return nil
+}
+
+func (c *concurrencyLimiter) release() {
+	<-c.slots
+}
+
+func isHealthMethod(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/"+healthgrpc.Health_ServiceDesc.ServiceName+"/")
+}
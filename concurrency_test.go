@@ -0,0 +1,152 @@
+package grpc_server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestConcurrencyMetrics(t *testing.T) {
+	t.Run("tracks requests in flight", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		release := make(chan struct{})
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(mock.Arguments) { <-release }).Return(&internal.Output{Value: "World"}, nil)
+
+		done := make(chan struct{})
+		for i := 0; i < 2; i++ {
+			go func() {
+				_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+				assert.Nil(t, err)
+				done <- struct{}{}
+			}()
+		}
+
+		labels := prometheus.Labels{"service": "internal.TestService", "method": "Endpoint"}
+
+		assert.Eventually(t, func() bool {
+			return metricValue(t, metrics.Collectors(), "grpc_request_in_flight", labels) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		close(release)
+		<-done
+		<-done
+
+		assert.Equal(t, float64(0), metricValue(t, metrics.Collectors(), "grpc_request_in_flight", labels))
+	})
+
+	t.Run("tracks the peak of requests in flight", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		rpc := newRPCInfo("/internal.TestService/Endpoint", unaryRPC)
+		start := time.Now()
+
+		for i := 0; i < 3; i++ {
+			metrics.recorder.RPCStarted(context.Background(), rpc)
+		}
+		for i := 0; i < 2; i++ {
+			metrics.recorder.RPCHandled(context.Background(), rpc, codes.OK, time.Since(start))
+		}
+
+		assert.Equal(t, float64(3), metricValue(t, metrics.Collectors(), "grpc_request_in_flight_peak", nil))
+		// collections do not reset the peak
+		assert.Equal(t, float64(3), metricValue(t, metrics.Collectors(), "grpc_request_in_flight_peak", nil))
+
+		for i := 0; i < 3; i++ {
+			metrics.recorder.RPCStarted(context.Background(), rpc)
+		}
+		assert.Equal(t, float64(4), metricValue(t, metrics.Collectors(), "grpc_request_in_flight_peak", nil))
+	})
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	t.Run("queues requests over the limit", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		mockServer, cc, cleanup := startTestServer(t, WithMetrics(metrics), WithConcurrencyLimit(1))
+		defer cleanup()
+
+		release := make(chan struct{})
+		mockServer.On("Endpoint", mock.Anything, inputWithValue("slow")).Run(func(mock.Arguments) { <-release }).Return(&internal.Output{Value: "World"}, nil)
+		mockServer.On("Endpoint", mock.Anything, inputWithValue("fast")).Return(&internal.Output{Value: "World"}, nil)
+
+		client := internal.NewTestServiceClient(cc)
+
+		done := make(chan struct{})
+		go func() {
+			_, err := client.Endpoint(context.Background(), &internal.Input{Value: "slow"}, grpc.WaitForReady(true))
+			assert.Nil(t, err)
+			close(done)
+		}()
+
+		labels := prometheus.Labels{"service": "internal.TestService", "method": "Endpoint"}
+		assert.Eventually(t, func() bool {
+			return metricValue(t, metrics.Collectors(), "grpc_request_in_flight", labels) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// the queued request fails when its deadline expires
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err = client.Endpoint(ctx, &internal.Input{Value: "fast"})
+		assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+		// queued requests are not in flight
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_request_in_flight_peak", nil))
+
+		// health checks are not limited
+		err = checkHealth(cc.Target(), insecure.NewCredentials())
+		assert.Nil(t, err)
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			close(release)
+		}()
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "fast"})
+		assert.Nil(t, err)
+		<-done
+
+		h := histogram(t, metrics.Collectors(), "grpc_request_queue_wait_seconds", labels)
+		assert.Equal(t, uint64(2), h.GetSampleCount())
+		assert.Greater(t, h.GetSampleSum(), 0.01)
+	})
+
+	t.Run("does not record the wait of excluded methods", func(t *testing.T) {
+		metrics, err := NewMetrics(WithExcludedMethods("/internal.TestService/Endpoint"))
+		assert.Nil(t, err)
+
+		mockServer, cc, cleanup := startTestServer(t, WithMetrics(metrics), WithConcurrencyLimit(1))
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+
+		registry := prometheus.NewPedanticRegistry()
+		registry.MustRegister(metrics.Collectors()...)
+		count, err := testutil.GatherAndCount(registry, "grpc_request_queue_wait_seconds")
+		assert.Nil(t, err)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("rejects invalid limits", func(t *testing.T) {
+		_, err := NewServer(WithConcurrencyLimit(0))
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package grpc_server
+
+import (
+	"net"
+	"os"
+)
+
+// dupListener returns a duplicate of the listener socket.
+func dupListener(grpcListener net.Listener) (*os.File, error) {
+	filer, ok := grpcListener.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, ErrUpgradeNotSupported
+	}
+	return filer.File()
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package grpc_server
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// dupListener returns a duplicate of the listener socket.
+// Unlike the File method of the listeners, it keeps the socket in non-blocking mode
+// when it is passed to another process: in blocking mode, the server could stay
+// blocked accepting connections after the listener is closed.
+func dupListener(grpcListener net.Listener) (*os.File, error) {
+	conn, ok := grpcListener.(syscall.Conn)
+	if !ok {
+		return nil, ErrUpgradeNotSupported
+	}
+
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var fd int
+	var dupErr error
+	err = rawConn.Control(func(listenerFd uintptr) {
+		syscall.ForkLock.RLock()
+		defer syscall.ForkLock.RUnlock()
+
+		fd, dupErr = syscall.Dup(int(listenerFd))
+		if dupErr == nil {
+			syscall.CloseOnExec(fd)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, dupErr
+	}
+
+	return os.NewFile(uintptr(fd), grpcListener.Addr().String()), nil
+}
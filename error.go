@@ -5,7 +5,7 @@ import (
 	"errors"
 	"fmt"
 
-	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -25,18 +25,27 @@ func IsApplicationError(err error) bool {
 // NewErrorInterceptor creates an interceptor that serializes application errors.
 //
 // Adding this interceptor adds a prometheus metric that counts application errors.
+// The metric is shared by all servers in the process: use Metrics.ErrorInterceptor
+// to count application errors in the metrics of a single server.
 //
 // Your application code should return errors implementing the ApplicationError
 // interface.
 func NewErrorInterceptor() grpc.UnaryServerInterceptor {
-	if applicationErrorCounter == nil {
-		applicationErrorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-			Namespace: "grpc",
-			Name:      "request_application_error_count_total",
-			Help:      "Counter for failed gRPC requests with application errors",
-		}, []string{"endpoint"})
-	}
+	return defaultMetrics().ErrorInterceptor()
+}
+
+// NewErrorStreamInterceptor creates the stream counterpart of NewErrorInterceptor.
+//
+// Application errors returned by stream handlers are serialized when the stream
+// is closed, and their trailer is sent to the client.
+func NewErrorStreamInterceptor() grpc.StreamServerInterceptor {
+	return defaultMetrics().ErrorStreamInterceptor()
+}
 
+// ErrorInterceptor creates an interceptor that serializes application errors,
+// like NewErrorInterceptor, and counts them in the metrics.
+// Application errors are also recorded on the span of the request, if any.
+func (m *Metrics) ErrorInterceptor() grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
 		req interface{},
@@ -52,7 +61,8 @@ func NewErrorInterceptor() grpc.UnaryServerInterceptor {
 		var applicationError ApplicationError
 
 		if errors.As(err, &applicationError) {
-			applicationErrorCounter.With(prometheus.Labels{"endpoint": info.FullMethod}).Inc()
+			m.recorder.ApplicationError(ctx, newRPCInfo(info.FullMethod, unaryRPC), applicationError.GRPCStatus().Code())
+			recordApplicationError(trace.SpanFromContext(ctx), applicationError)
 
 			err = grpc.SetTrailer(ctx, applicationError.Trailer())
 			if err != nil {
@@ -65,3 +75,32 @@ func NewErrorInterceptor() grpc.UnaryServerInterceptor {
 		return nil, err
 	}
 }
+
+// ErrorStreamInterceptor creates the stream counterpart of ErrorInterceptor.
+func (m *Metrics) ErrorStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		err := handler(srv, ss)
+
+		if err == nil {
+			return nil
+		}
+
+		var applicationError ApplicationError
+
+		if errors.As(err, &applicationError) {
+			m.recorder.ApplicationError(ss.Context(), newRPCInfo(info.FullMethod, streamRPCType(info)), applicationError.GRPCStatus().Code())
+			recordApplicationError(trace.SpanFromContext(ss.Context()), applicationError)
+
+			ss.SetTrailer(applicationError.Trailer())
+
+			return applicationError.GRPCStatus().Err()
+		}
+
+		return err
+	}
+}
@@ -127,4 +127,59 @@ func TestErrorInterceptor(t *testing.T) {
 		assert.Equal(t, codes.Unknown, grpcErr.GRPCStatus().Code())
 		assert.Nil(t, md["code"])
 	})
+
+	t.Run("handles application errors on streams", func(t *testing.T) {
+		client, mockServer, cleanup := setupTestStreamServer(t, NewErrorStreamInterceptor())
+		defer cleanup()
+
+		ctx := context.Background()
+
+		applicationError := &testApplicationError{
+			message:  "Failed",
+			grpcCode: codes.InvalidArgument,
+			code:     "APPLICATION_ERROR",
+		}
+
+		mockServer.On("Stream", mock.Anything).Return(applicationError)
+
+		stream, err := client.Stream(ctx)
+		assert.Nil(t, err)
+
+		_, err = stream.Recv()
+
+		assert.NotNil(t, err)
+		grpcErr, ok := err.(GRPCStatus)
+		assert.True(t, ok)
+		assert.Equal(t, "Failed", grpcErr.GRPCStatus().Message())
+		assert.Equal(t, codes.InvalidArgument, grpcErr.GRPCStatus().Code())
+		assert.Equal(t, []string{"APPLICATION_ERROR"}, stream.Trailer()["code"])
+	})
+
+	t.Run("handles application panics on streams", func(t *testing.T) {
+		client, mockServer, cleanup := setupTestStreamServer(t, NewErrorStreamInterceptor(), RecoverStreamInterceptor)
+		defer cleanup()
+
+		ctx := context.Background()
+
+		applicationError := &testApplicationError{
+			message:  "Failed",
+			grpcCode: codes.InvalidArgument,
+			code:     "APPLICATION_ERROR",
+		}
+
+		mockServer.On("Stream", mock.Anything).Run(func(args mock.Arguments) {
+			panic(applicationError)
+		})
+
+		stream, err := client.Stream(ctx)
+		assert.Nil(t, err)
+
+		_, err = stream.Recv()
+
+		assert.NotNil(t, err)
+		grpcErr, ok := err.(GRPCStatus)
+		assert.True(t, ok)
+		assert.Equal(t, codes.InvalidArgument, grpcErr.GRPCStatus().Code())
+		assert.Equal(t, []string{"APPLICATION_ERROR"}, stream.Trailer()["code"])
+	})
 }
@@ -0,0 +1,148 @@
+package grpc_server
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+// ExemplarFunc returns the exemplar labels to attach to the metrics of a request,
+// e.g. the trace_id and span_id of the trace the request belongs to,
+// or nil if the request has no exemplar.
+type ExemplarFunc func(ctx context.Context) prometheus.Labels
+
+// maxExemplarRunes is the maximum length of the names and values of exemplar labels,
+// as defined by OpenMetrics.
+const maxExemplarRunes = 128
+
+// WithExemplars sets the function that extracts exemplars from the context of the requests.
+// Exemplars are attached to the latency histogram and the request and error counters,
+// and link each sample to the trace of a request.
+//
+// The default is TraceExemplar. Pass nil to disable exemplars.
+// Exemplars are only exposed with the OpenMetrics format,
+// e.g. with the EnableOpenMetrics option of promhttp.
+func WithExemplars(exemplar ExemplarFunc) MetricsOption {
+	return func(c *metricsConfig) error {
+		c.exemplar = exemplar
+		return nil
+	}
+}
+
+// TraceExemplar returns the trace_id and span_id labels of the sampled span in the context,
+// e.g. the span created by the tracing interceptors,
+// falling back to the traceparent header in the incoming metadata.
+func TraceExemplar(ctx context.Context) prometheus.Labels {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.IsValid() {
+		if !spanContext.IsSampled() {
+			return nil
+		}
+		return prometheus.Labels{
+			"trace_id": spanContext.TraceID().String(),
+			"span_id":  spanContext.SpanID().String(),
+		}
+	}
+
+	return TraceparentExemplar(ctx)
+}
+
+// TraceparentExemplar returns the trace_id and span_id labels
+// taken from the W3C traceparent header in the incoming metadata.
+// Requests that are not sampled by the caller have no exemplar.
+func TraceparentExemplar(ctx context.Context) prometheus.Labels {
+	values := metadata.ValueFromIncomingContext(ctx, "traceparent")
+	if len(values) == 0 {
+		return nil
+	}
+
+	// version-traceid-parentid-flags, e.g. 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(strings.TrimSpace(values[0]), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return nil
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return nil
+	}
+
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isTraceHex(traceID, 32) || !isTraceHex(spanID, 16) || !isTraceHex(flags, 2) {
+		return nil
+	}
+
+	// the sampled flag is the lowest bit of the flags
+	if !strings.ContainsAny(flags[1:], "13579bdf") {
+		return nil
+	}
+
+	return prometheus.Labels{"trace_id": traceID, "span_id": spanID}
+}
+
+// isTraceHex reports whether s is a lowercase hex string of the given length,
+// that is not all zeros.
+func isTraceHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+
+	nonZero := false
+	for _, c := range s {
+		switch {
+		case c == '0':
+		case '1' <= c && c <= '9', 'a' <= c && c <= 'f':
+			nonZero = true
+		default:
+			return false
+		}
+	}
+	return nonZero || length == 2
+}
+
+// exemplarLabels returns the exemplar of a request,
+// dropping exemplars that prometheus would reject.
+func (m *prometheusRecorder) exemplarLabels(ctx context.Context) prometheus.Labels {
+	if m.exemplar == nil {
+		return nil
+	}
+
+	labels := m.exemplar(ctx)
+	if len(labels) == 0 {
+		return nil
+	}
+
+	runes := 0
+	for name, value := range labels {
+		if !model.LabelName(name).IsValid() || !utf8.ValidString(value) {
+			return nil
+		}
+		runes += utf8.RuneCountInString(name) + utf8.RuneCountInString(value)
+	}
+	if runes > maxExemplarRunes {
+		return nil
+	}
+
+	return labels
+}
+
+// observe records a value in a histogram, with an exemplar if there is one.
+func observe(observer prometheus.Observer, value float64, exemplar prometheus.Labels) {
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && exemplar != nil {
+		exemplarObserver.ObserveWithExemplar(value, exemplar)
+		return
+	}
+	observer.Observe(value)
+}
+
+// inc increments a counter, with an exemplar if there is one.
+func inc(counter prometheus.Counter, exemplar prometheus.Labels) {
+	if exemplarAdder, ok := counter.(prometheus.ExemplarAdder); ok && exemplar != nil {
+		exemplarAdder.AddWithExemplar(1, exemplar)
+		return
+	}
+	counter.Inc()
+}
@@ -0,0 +1,140 @@
+package grpc_server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func exemplarLabels(exemplar *dto.Exemplar) map[string]string {
+	if exemplar == nil {
+		return nil
+	}
+
+	labels := make(map[string]string)
+	for _, label := range exemplar.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+	return labels
+}
+
+func histogramExemplar(h *dto.Histogram) *dto.Exemplar {
+	for _, bucket := range h.GetBucket() {
+		if bucket.GetExemplar() != nil {
+			return bucket.GetExemplar()
+		}
+	}
+	return nil
+}
+
+func TestExemplars(t *testing.T) {
+	t.Run("attaches the trace of the request", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", testTraceparent)
+		_, err = client.Endpoint(ctx, &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		expected := map[string]string{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7"}
+
+		h := histogram(t, metrics.Collectors(), "grpc_request_duration_seconds", nil)
+		assert.Equal(t, expected, exemplarLabels(histogramExemplar(h)))
+
+		counter := findMetric(t, metrics.Collectors(), "grpc_request_count_total", prometheus.Labels{"code": "OK"}).GetCounter()
+		assert.Equal(t, expected, exemplarLabels(counter.GetExemplar()))
+	})
+
+	t.Run("skips requests without a sampled trace", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		_, err = client.Endpoint(ctx, &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		h := histogram(t, metrics.Collectors(), "grpc_request_duration_seconds", nil)
+		assert.Equal(t, uint64(2), h.GetSampleCount())
+		assert.Nil(t, histogramExemplar(h))
+	})
+
+	t.Run("uses the configured exemplar function", func(t *testing.T) {
+		metrics, err := NewMetrics(WithExemplars(func(ctx context.Context) prometheus.Labels {
+			return prometheus.Labels{"request_id": "abc"}
+		}))
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor(), metrics.ErrorInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, &testApplicationError{message: "not found", grpcCode: codes.NotFound, code: "NOT_FOUND"})
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.NotNil(t, err)
+
+		counter := findMetric(t, metrics.Collectors(), "grpc_request_application_error_count_total", nil).GetCounter()
+		assert.Equal(t, map[string]string{"request_id": "abc"}, exemplarLabels(counter.GetExemplar()))
+	})
+
+	t.Run("drops invalid exemplars", func(t *testing.T) {
+		metrics, err := NewMetrics(WithExemplars(func(ctx context.Context) prometheus.Labels {
+			return prometheus.Labels{"invalid-name": "value"}
+		}))
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		h := histogram(t, metrics.Collectors(), "grpc_request_duration_seconds", nil)
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+		assert.Nil(t, histogramExemplar(h))
+	})
+}
+
+func TestTraceparentExemplar(t *testing.T) {
+	tests := map[string]prometheus.Labels{
+		testTraceparent: {"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7"},
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-03-future": {"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7"},
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00":        nil,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":        nil,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":        nil,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":        nil,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra":  nil,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":        nil,
+		"not a traceparent": nil,
+	}
+
+	for traceparent, expected := range tests {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", traceparent))
+		assert.Equal(t, expected, TraceparentExemplar(ctx), traceparent)
+	}
+
+	assert.Nil(t, TraceparentExemplar(context.Background()))
+}
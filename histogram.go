@@ -0,0 +1,119 @@
+package grpc_server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultLatencyBuckets go from 0.5ms to about 16s.
+var defaultLatencyBuckets = prometheus.ExponentialBuckets(0.0005, 2, 16)
+
+// WithHistogramBuckets sets the buckets of the latency histogram, in seconds.
+func WithHistogramBuckets(buckets ...float64) MetricsOption {
+	return func(c *metricsConfig) error {
+		if err := validateBuckets(buckets); err != nil {
+			return err
+		}
+		c.buckets = buckets
+		return nil
+	}
+}
+
+// WithMethodHistogramBuckets sets the buckets of the latency histogram, in seconds,
+// for a single method, e.g. /package.Service/Method.
+// The other methods use the buckets set with WithHistogramBuckets.
+func WithMethodHistogramBuckets(method string, buckets ...float64) MetricsOption {
+	return func(c *metricsConfig) error {
+		if method == "" {
+			return errors.New("method must not be empty")
+		}
+		if err := validateBuckets(buckets); err != nil {
+			return fmt.Errorf("invalid buckets for %s: %w", method, err)
+		}
+		if c.methodBuckets == nil {
+			c.methodBuckets = make(map[string][]float64)
+		}
+		c.methodBuckets[method] = buckets
+		return nil
+	}
+}
+
+// WithNativeHistograms makes the latency histogram a Prometheus native histogram,
+// in addition to the classic buckets. The bucket factor sets the resolution
+// of the histogram: each bucket is at most bucketFactor times wider than the previous one,
+// e.g. 1.1 for a resolution of 10%.
+//
+// Native histograms are only exposed with the protobuf exposition format.
+func WithNativeHistograms(bucketFactor float64) MetricsOption {
+	return func(c *metricsConfig) error {
+		if bucketFactor <= 1 {
+			return fmt.Errorf("invalid native histogram bucket factor %v", bucketFactor)
+		}
+		c.nativeBucketFactor = bucketFactor
+		return nil
+	}
+}
+
+func validateBuckets(buckets []float64) error {
+	if len(buckets) == 0 {
+		return errors.New("histogram buckets must not be empty")
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return errors.New("histogram buckets must be in increasing order")
+		}
+	}
+	return nil
+}
+
+// histogramSet is a histogram vector whose buckets can be overridden per method.
+// All the vectors have the same description, so they are exposed as a single metric.
+type histogramSet struct {
+	histogram       *prometheus.HistogramVec
+	methodHistogram map[string]*prometheus.HistogramVec
+}
+
+func newHistogramSet(opts prometheus.HistogramOpts, labels []string, config *metricsConfig) *histogramSet {
+	if config.nativeBucketFactor > 0 {
+		opts.NativeHistogramBucketFactor = config.nativeBucketFactor
+		opts.NativeHistogramMaxBucketNumber = 160
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+	if config.buckets != nil {
+		opts.Buckets = config.buckets
+	}
+
+	h := &histogramSet{
+		histogram:       prometheus.NewHistogramVec(opts, labels),
+		methodHistogram: make(map[string]*prometheus.HistogramVec),
+	}
+
+	for method, buckets := range config.methodBuckets {
+		methodOpts := opts
+		methodOpts.Buckets = buckets
+		h.methodHistogram[method] = prometheus.NewHistogramVec(methodOpts, labels)
+	}
+
+	return h
+}
+
+func (h *histogramSet) Describe(ch chan<- *prometheus.Desc) {
+	h.histogram.Describe(ch)
+}
+
+func (h *histogramSet) Collect(ch chan<- prometheus.Metric) {
+	h.histogram.Collect(ch)
+	for _, histogram := range h.methodHistogram {
+		histogram.Collect(ch)
+	}
+}
+
+func (h *histogramSet) with(fullMethod string, labels prometheus.Labels) prometheus.Observer {
+	if histogram, ok := h.methodHistogram[fullMethod]; ok {
+		return histogram.With(labels)
+	}
+	return h.histogram.With(labels)
+}
@@ -0,0 +1,180 @@
+package grpc_server
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// PeerIdentity is the identity of a client,
+// extracted from the client certificate verified during the mutual TLS handshake.
+type PeerIdentity struct {
+	// SPIFFEID is the first URI SAN with the spiffe scheme, if any.
+	SPIFFEID       string
+	CommonName     string
+	DNSNames       []string
+	URIs           []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	Certificate    *x509.Certificate
+}
+
+type peerIdentityKey struct{}
+
+// PeerIdentityFromContext returns the identity of the client,
+// stored in the context by the identity interceptors.
+func PeerIdentityFromContext(ctx context.Context) (*PeerIdentity, bool) {
+	identity, ok := ctx.Value(peerIdentityKey{}).(*PeerIdentity)
+	return identity, ok
+}
+
+// NewIdentityInterceptor creates an interceptor that extracts the identity of the client
+// from its verified TLS certificate, and stores it in the request context.
+//
+// If a list of allowed identities is given, requests without a client certificate
+// are rejected with Unauthenticated, and requests from clients whose SPIFFE ID,
+// SANs or common name are not in the list are rejected with PermissionDenied.
+func NewIdentityInterceptor(allowed ...string) grpc.UnaryServerInterceptor {
+	allowedIdentities := allowedIdentitySet(allowed)
+
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		ctx, err = authenticatePeer(ctx, allowedIdentities)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// NewIdentityStreamInterceptor creates the stream counterpart of NewIdentityInterceptor.
+func NewIdentityStreamInterceptor(allowed ...string) grpc.StreamServerInterceptor {
+	allowedIdentities := allowedIdentitySet(allowed)
+
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := authenticatePeer(ss.Context(), allowedIdentities)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func allowedIdentitySet(allowed []string) map[string]bool {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	allowedIdentities := make(map[string]bool)
+	for _, identity := range allowed {
+		allowedIdentities[identity] = true
+	}
+	return allowedIdentities
+}
+
+func authenticatePeer(ctx context.Context, allowedIdentities map[string]bool) (context.Context, error) {
+	identity := peerIdentity(ctx)
+
+	if allowedIdentities != nil {
+		if identity == nil {
+			return nil, status.Error(codes.Unauthenticated, "missing client certificate")
+		}
+		if !identity.allowed(allowedIdentities) {
+			return nil, status.Error(codes.PermissionDenied, "client identity is not allowed")
+		}
+	}
+
+	if identity == nil {
+		return ctx, nil
+	}
+
+	return context.WithValue(ctx, peerIdentityKey{}, identity), nil
+}
+
+// peerIdentityID returns the SPIFFE ID of the client, or its common name,
+// taken from the context or from the TLS handshake.
+func peerIdentityID(ctx context.Context) (string, bool) {
+	identity, ok := PeerIdentityFromContext(ctx)
+	if !ok {
+		identity = peerIdentity(ctx)
+	}
+	if identity == nil {
+		return "", false
+	}
+
+	id := identity.SPIFFEID
+	if id == "" {
+		id = identity.CommonName
+	}
+	return id, id != ""
+}
+
+func peerIdentity(ctx context.Context) *PeerIdentity {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	certificate := tlsInfo.State.VerifiedChains[0][0]
+
+	identity := &PeerIdentity{
+		CommonName:     certificate.Subject.CommonName,
+		DNSNames:       certificate.DNSNames,
+		EmailAddresses: certificate.EmailAddresses,
+		IPAddresses:    certificate.IPAddresses,
+		Certificate:    certificate,
+	}
+
+	for _, uri := range certificate.URIs {
+		identity.URIs = append(identity.URIs, uri.String())
+		if uri.Scheme == "spiffe" && identity.SPIFFEID == "" {
+			identity.SPIFFEID = uri.String()
+		}
+	}
+
+	return identity
+}
+
+func (p *PeerIdentity) allowed(allowedIdentities map[string]bool) bool {
+	if p.CommonName != "" && allowedIdentities[p.CommonName] {
+		return true
+	}
+
+	for _, names := range [][]string{p.URIs, p.DNSNames, p.EmailAddresses} {
+		for _, name := range names {
+			if allowedIdentities[name] {
+				return true
+			}
+		}
+	}
+
+	for _, ip := range p.IPAddresses {
+		if allowedIdentities[ip.String()] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+package grpc_server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+func TestIdentityInterceptor(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificateAuthority(t, dir)
+	serverCert := ca.issue(t, dir, "server", time.Now().Add(time.Hour), nil)
+	clientCert := ca.issue(t, dir, "client", time.Now().Add(time.Hour), func(template *x509.Certificate) {
+		spiffeID, _ := url.Parse("spiffe://example.org/ns/default/sa/client")
+		template.URIs = []*url.URL{spiffeID}
+		template.DNSNames = []string{"client.example.org"}
+	})
+
+	clientCreds := credentials.NewTLS(&tls.Config{
+		RootCAs:      ca.pool(),
+		Certificates: []tls.Certificate{clientCert.certificate},
+	})
+
+	t.Run("stores the peer identity in the context", func(t *testing.T) {
+		mockServer, cc, cleanup := startTestServerWithCredentials(
+			t,
+			clientCreds,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithClientCA(ca.file),
+			WithUnaryInterceptors(NewIdentityInterceptor()),
+		)
+		defer cleanup()
+
+		var identity *PeerIdentity
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			identity, _ = PeerIdentityFromContext(args.Get(0).(context.Context))
+		}).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err := internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+
+		if assert.NotNil(t, identity) {
+			assert.Equal(t, "spiffe://example.org/ns/default/sa/client", identity.SPIFFEID)
+			assert.Equal(t, "client", identity.CommonName)
+			assert.Equal(t, []string{"client.example.org"}, identity.DNSNames)
+			assert.Equal(t, []string{"spiffe://example.org/ns/default/sa/client"}, identity.URIs)
+			assert.Equal(t, "127.0.0.1", identity.IPAddresses[0].String())
+		}
+	})
+
+	t.Run("stores the peer identity in the stream context", func(t *testing.T) {
+		mockServer, cc, cleanup := startTestServerWithCredentials(
+			t,
+			clientCreds,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithClientCA(ca.file),
+			WithStreamInterceptors(NewIdentityStreamInterceptor()),
+		)
+		defer cleanup()
+
+		var identity *PeerIdentity
+		mockServer.On("Stream", mock.Anything).Run(func(args mock.Arguments) {
+			identity, _ = PeerIdentityFromContext(args.Get(0).(internal.TestService_StreamServer).Context())
+		}).Return(nil)
+
+		stream, err := internal.NewTestServiceClient(cc).Stream(context.Background(), grpc.WaitForReady(true))
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.NotNil(t, err)
+
+		if assert.NotNil(t, identity) {
+			assert.Equal(t, "spiffe://example.org/ns/default/sa/client", identity.SPIFFEID)
+		}
+	})
+
+	t.Run("allows listed identities", func(t *testing.T) {
+		mockServer, cc, cleanup := startTestServerWithCredentials(
+			t,
+			clientCreds,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithClientCA(ca.file),
+			WithUnaryInterceptors(NewIdentityInterceptor("spiffe://example.org/ns/default/sa/client")),
+		)
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err := internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+	})
+
+	t.Run("rejects identities that are not listed", func(t *testing.T) {
+		_, cc, cleanup := startTestServerWithCredentials(
+			t,
+			clientCreds,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithClientCA(ca.file),
+			WithUnaryInterceptors(NewIdentityInterceptor("spiffe://example.org/ns/default/sa/other")),
+			WithStreamInterceptors(NewIdentityStreamInterceptor("other.example.org")),
+		)
+		defer cleanup()
+
+		client := internal.NewTestServiceClient(cc)
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+		stream, err := client.Stream(context.Background(), grpc.WaitForReady(true))
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	})
+
+	t.Run("rejects callers without a client certificate", func(t *testing.T) {
+		_, cc, cleanup := startTestServerWithCredentials(
+			t,
+			credentials.NewTLS(&tls.Config{RootCAs: ca.pool()}),
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithUnaryInterceptors(NewIdentityInterceptor("client")),
+		)
+		defer cleanup()
+
+		_, err := internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
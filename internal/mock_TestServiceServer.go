@@ -80,6 +80,52 @@ func (_c *MockTestServiceServer_Endpoint_Call) RunAndReturn(run func(context.Con
 	return _c
 }
 
+// Stream provides a mock function with given fields: _a0
+func (_m *MockTestServiceServer) Stream(_a0 TestService_StreamServer) error {
+	ret := _m.Called(_a0)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Stream")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(TestService_StreamServer) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// MockTestServiceServer_Stream_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'Stream'
+type MockTestServiceServer_Stream_Call struct {
+	*mock.Call
+}
+
+// Stream is a helper method to define mock.On call
+//   - _a0 TestService_StreamServer
+func (_e *MockTestServiceServer_Expecter) Stream(_a0 interface{}) *MockTestServiceServer_Stream_Call {
+	return &MockTestServiceServer_Stream_Call{Call: _e.mock.On("Stream", _a0)}
+}
+
+func (_c *MockTestServiceServer_Stream_Call) Run(run func(_a0 TestService_StreamServer)) *MockTestServiceServer_Stream_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		run(args[0].(TestService_StreamServer))
+	})
+	return _c
+}
+
+func (_c *MockTestServiceServer_Stream_Call) Return(_a0 error) *MockTestServiceServer_Stream_Call {
+	_c.Call.Return(_a0)
+	return _c
+}
+
+func (_c *MockTestServiceServer_Stream_Call) RunAndReturn(run func(TestService_StreamServer) error) *MockTestServiceServer_Stream_Call {
+	_c.Call.Return(run)
+	return _c
+}
+
 // mustEmbedUnimplementedTestServiceServer provides a mock function with given fields:
 func (_m *MockTestServiceServer) mustEmbedUnimplementedTestServiceServer() {
 	_m.Called()
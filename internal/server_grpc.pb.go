@@ -20,6 +20,7 @@ const _ = grpc.SupportPackageIsVersion7
 
 const (
 	TestService_Endpoint_FullMethodName = "/internal.TestService/Endpoint"
+	TestService_Stream_FullMethodName   = "/internal.TestService/Stream"
 )
 
 // TestServiceClient is the client API for TestService service.
@@ -27,6 +28,7 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type TestServiceClient interface {
 	Endpoint(ctx context.Context, in *Input, opts ...grpc.CallOption) (*Output, error)
+	Stream(ctx context.Context, opts ...grpc.CallOption) (TestService_StreamClient, error)
 }
 
 type testServiceClient struct {
@@ -46,11 +48,43 @@ func (c *testServiceClient) Endpoint(ctx context.Context, in *Input, opts ...grp
 	return out, nil
 }
 
+func (c *testServiceClient) Stream(ctx context.Context, opts ...grpc.CallOption) (TestService_StreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &TestService_ServiceDesc.Streams[0], TestService_Stream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &testServiceStreamClient{stream}
+	return x, nil
+}
+
+type TestService_StreamClient interface {
+	Send(*Input) error
+	Recv() (*Output, error)
+	grpc.ClientStream
+}
+
+type testServiceStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *testServiceStreamClient) Send(m *Input) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *testServiceStreamClient) Recv() (*Output, error) {
+	m := new(Output)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // TestServiceServer is the server API for TestService service.
 // All implementations must embed UnimplementedTestServiceServer
 // for forward compatibility
 type TestServiceServer interface {
 	Endpoint(context.Context, *Input) (*Output, error)
+	Stream(TestService_StreamServer) error
 	mustEmbedUnimplementedTestServiceServer()
 }
 
@@ -61,6 +95,9 @@ type UnimplementedTestServiceServer struct {
 func (UnimplementedTestServiceServer) Endpoint(context.Context, *Input) (*Output, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Endpoint not implemented")
 }
+func (UnimplementedTestServiceServer) Stream(TestService_StreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
 func (UnimplementedTestServiceServer) mustEmbedUnimplementedTestServiceServer() {}
 
 // UnsafeTestServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -92,6 +129,32 @@ func _TestService_Endpoint_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TestService_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TestServiceServer).Stream(&testServiceStreamServer{stream})
+}
+
+type TestService_StreamServer interface {
+	Send(*Output) error
+	Recv() (*Input, error)
+	grpc.ServerStream
+}
+
+type testServiceStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *testServiceStreamServer) Send(m *Output) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *testServiceStreamServer) Recv() (*Input, error) {
+	m := new(Input)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // TestService_ServiceDesc is the grpc.ServiceDesc for TestService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -104,6 +167,13 @@ var TestService_ServiceDesc = grpc.ServiceDesc{
 			Handler:    _TestService_Endpoint_Handler,
 		},
 	},
-	Streams:  []grpc.StreamDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _TestService_Stream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
 	Metadata: "server.proto",
 }
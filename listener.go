@@ -1,50 +1,209 @@
 package grpc_server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/health"
 	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 type GrpcServer interface {
+	// Start binds the server and serves requests in the background.
+	// It terminates the process if the server cannot bind or fails while serving.
 	Start()
+	// Listen binds the server synchronously, returning the bind error if any,
+	// and serves requests in the background.
+	Listen() error
+	// Wait blocks until the server stops serving,
+	// and returns the error that made it stop, if any.
+	Wait() error
+	// Run starts the server and blocks until the context is cancelled,
+	// then stops the server gracefully. It returns the first error
+	// encountered while binding, serving or stopping the server.
+	// When the process receives one of the signals set with WithUpgradeSignal,
+	// Run upgrades the server and returns once it is stopped.
+	Run(ctx context.Context) error
+	// Addr returns the address the server is bound to,
+	// or nil if the server has not been started.
+	// Use it to find the port assigned when listening on port 0.
+	Addr() net.Addr
+	// Upgrade starts a new process with the upgrade command, which defaults to
+	// the command line of the current process, and hands over the listener to it.
+	// Once the new process is serving requests, the server is stopped gracefully,
+	// without the pre-stop delay and while still reporting that it is serving.
+	// If the new process fails to start, the server keeps serving requests.
+	Upgrade() error
 	GetServer() *grpc.Server
 	GetMetrics() []prometheus.Collector
+	// Stop stops the server gracefully.
+	// The server is stopped once: later calls return the error of the first one.
 	Stop() error
 }
 
-var requestTimesMonitor *prometheus.HistogramVec
-
 var (
-	requestCounter          *prometheus.CounterVec
-	errorCounter            *prometheus.CounterVec
-	applicationErrorCounter *prometheus.CounterVec
+	ErrServerStarted    = errors.New("gRPC server already started")
+	ErrServerNotStarted = errors.New("gRPC server not started")
 )
 
 type listener struct {
 	server      *grpc.Server
 	healthcheck *health.Server
 	listener    net.Listener
-	port        int
+	network     string
+	address     string
+	socketMode  os.FileMode
+
+	socketActivation     bool
+	socketActivationName string
+
+	preStopDelay   time.Duration
+	drainTimeout   time.Duration
+	activeRequests int64
+
+	metrics  *Metrics
+	logger   Logger
+	redactor *Redactor
+	reloader *certificateReloader
+
+	upgradeCommand []string
+	upgradeTimeout time.Duration
+	upgradeSignals []os.Signal
+	upgradeMu      sync.Mutex
+	readyFile      *os.File
+
+	mu       sync.Mutex
+	done     chan struct{}
+	serveErr error
+
+	stopOnce sync.Once
+	stopErr  error
 }
 
+// NewGrpcServer creates a gRPC server listening on the given port,
+// that registers the given unary interceptors.
+//
+// Use NewServer to configure the server with options.
 func NewGrpcServer(port int, interceptors ...grpc.UnaryServerInterceptor) GrpcServer {
-	grpcServer := grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...), grpc.MaxHeaderListSize(8*1024*1024))
+	return NewGrpcServerWithInterceptors(port, interceptors, nil)
+}
+
+// NewGrpcServerWithInterceptors creates a gRPC server that registers both unary
+// and stream interceptors, in the order they are passed.
+//
+// Use NewServer to configure the server with options.
+func NewGrpcServerWithInterceptors(
+	port int,
+	unaryInterceptors []grpc.UnaryServerInterceptor,
+	streamInterceptors []grpc.StreamServerInterceptor,
+) GrpcServer {
+	server, err := NewServer(
+		WithPort(port),
+		WithUnaryInterceptors(unaryInterceptors...),
+		WithStreamInterceptors(streamInterceptors...),
+	)
+	if err != nil {
+		panic(fmt.Errorf("failed to create gRPC server: %w", err))
+	}
+	return server
+}
+
+// NewServer creates a gRPC server configured with the given options.
+func NewServer(opts ...Option) (GrpcServer, error) {
+	config := defaultServerConfig()
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	network, address := config.network, config.address
+	if network == "" {
+		network, address = "tcp", fmt.Sprintf(":%d", config.port)
+	}
+
+	l := &listener{
+		listener:   config.listener,
+		network:    network,
+		address:    address,
+		socketMode: config.socketMode,
+
+		socketActivation:     config.socketActivation,
+		socketActivationName: config.socketActivationName,
+
+		metrics:  config.metrics,
+		logger:   config.logger,
+		redactor: config.redactor,
+
+		preStopDelay: config.preStopDelay,
+		drainTimeout: config.drainTimeout,
 
-	healthcheck := health.NewServer()
-	healthgrpc.RegisterHealthServer(grpcServer, healthcheck)
+		upgradeCommand: config.upgradeCommand,
+		upgradeTimeout: config.upgradeTimeout,
+		upgradeSignals: config.upgradeSignals,
+	}
+
+	unaryInterceptors := []grpc.UnaryServerInterceptor{l.trackUnary}
+	streamInterceptors := []grpc.StreamServerInterceptor{l.trackStream}
+	if config.tracing != nil {
+		// the span covers the whole RPC, and is seen by the metrics exemplars
+		unaryInterceptors = append(unaryInterceptors, config.tracing.UnaryInterceptor())
+		streamInterceptors = append(streamInterceptors, config.tracing.StreamInterceptor())
+	}
+	if config.concurrencyLimit > 0 {
+		// requests waiting for the limit are not in flight yet,
+		// and their wait is recorded apart from their latency
+		limiter := newConcurrencyLimiter(config.concurrencyLimit, config.metrics)
+		unaryInterceptors = append(unaryInterceptors, limiter.unary)
+		streamInterceptors = append(streamInterceptors, limiter.stream)
+	}
+	if config.metrics != nil {
+		// the metrics interceptors come right after tracing and the concurrency limit,
+		// to observe the status returned to clients
+		unaryInterceptors = append(unaryInterceptors, config.metrics.UnaryInterceptor())
+		streamInterceptors = append(streamInterceptors, config.metrics.StreamInterceptor())
+	}
+	if config.accessLog != nil {
+		unaryInterceptors = append(unaryInterceptors, config.accessLog.UnaryInterceptor())
+		streamInterceptors = append(streamInterceptors, config.accessLog.StreamInterceptor())
+	}
 
-	return &listener{
-		server:      grpcServer,
-		port:        port,
-		healthcheck: healthcheck,
+	serverOptions := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(append(unaryInterceptors, config.unaryInterceptors...)...),
+		grpc.ChainStreamInterceptor(append(streamInterceptors, config.streamInterceptors...)...),
+		grpc.MaxHeaderListSize(8 * 1024 * 1024),
 	}
+	if config.tls != nil {
+		serverAddress := address
+		if config.listener != nil {
+			serverAddress = config.listener.Addr().String()
+		}
+		tlsConfig, reloader, err := config.tls.build(tlsMetricLabels(config.metrics, serverAddress))
+		if err != nil {
+			return nil, err
+		}
+		l.reloader = reloader
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	serverOptions = append(serverOptions, config.serverOptions...)
+
+	l.server = grpc.NewServer(serverOptions...)
+
+	if config.health {
+		l.healthcheck = health.NewServer()
+		healthgrpc.RegisterHealthServer(l.server, l.healthcheck)
+	}
+
+	return l, nil
 }
 
 func (l *listener) GetServer() *grpc.Server {
@@ -53,51 +212,199 @@ func (l *listener) GetServer() *grpc.Server {
 
 func (l *listener) GetMetrics() []prometheus.Collector {
 	res := make([]prometheus.Collector, 0)
-	if requestTimesMonitor != nil {
-		res = append(res, requestTimesMonitor)
-	}
-	if requestCounter != nil {
-		res = append(res, requestCounter)
-	}
-	if applicationErrorCounter != nil {
-		res = append(res, applicationErrorCounter)
+	if l.metrics != nil {
+		res = append(res, l.metrics.Collectors()...)
+	} else {
+		defaultMetricsMu.Lock()
+		if defaultMetricsInstance != nil {
+			res = append(res, defaultMetricsInstance.Collectors()...)
+		}
+		defaultMetricsMu.Unlock()
 	}
-	if errorCounter != nil {
-		res = append(res, errorCounter)
+	if l.reloader != nil {
+		res = append(res, l.reloader.collectors()...)
 	}
 	return res
 }
 
 func (l *listener) Start() {
+	err := l.Listen()
+	if err != nil {
+		l.logf(LevelError, "failed to listen: %v", err)
+		os.Exit(1)
+	}
+
 	go func() {
-		grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%d", l.port))
+		err := l.Wait()
 		if err != nil {
-			log.Fatalf("failed to listen: %v", err)
+			l.logf(LevelError, "gRPC server failed: %v", err)
+			os.Exit(1)
 		}
+	}()
+}
 
-		l.listener = grpcListener
+func (l *listener) Listen() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-		l.healthcheck.SetServingStatus("", healthgrpc.HealthCheckResponse_SERVING)
+	if l.done != nil {
+		return ErrServerStarted
+	}
+
+	if l.listener == nil {
+		inherited, readyFile, err := inheritedListener(l.address)
+		if err != nil {
+			return err
+		}
+		l.listener = inherited
+		l.readyFile = readyFile
+	}
 
-		err = l.server.Serve(l.listener)
+	if l.listener == nil && l.socketActivation {
+		activated, err := activatedListener(l.socketActivationName)
 		if err != nil {
-			log.Fatalf("gRPC server failed: %v", err)
+			return err
+		}
+		if activated == nil {
+			l.logf(LevelDebug, "no socket passed with socket activation, binding %s %s", l.network, l.address)
+		}
+		l.listener = activated
+	}
+
+	if l.listener == nil {
+		grpcListener, err := bind(l.network, l.address, l.socketMode)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s %s: %w", l.network, l.address, err)
+		}
+
+		l.listener = grpcListener
+	}
+
+	l.done = make(chan struct{})
+
+	if l.reloader != nil {
+		l.reloader.start(l.logger)
+	}
+
+	l.setServingStatus(healthgrpc.HealthCheckResponse_SERVING)
+
+	go func() {
+		defer close(l.done)
+
+		err := l.server.Serve(l.listener)
+		// the server was stopped before it started serving
+		if !errors.Is(err, grpc.ErrServerStopped) {
+			l.serveErr = err
 		}
 	}()
 
-	log.Infof("gRPC server listening on port %d", l.port)
+	l.logf(LevelInfo, "gRPC server listening on %s", l.listener.Addr())
+
+	// report to the process that handed over the listener that this one is ready
+	if l.readyFile != nil {
+		if _, err := l.readyFile.Write([]byte{1}); err != nil {
+			l.logf(LevelError, "failed to report readiness to the previous process: %v", err)
+		}
+		l.readyFile.Close()
+		l.readyFile = nil
+	}
+
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.done == nil {
+		return nil
+	}
+
+	return l.listener.Addr()
+}
+
+func (l *listener) Wait() error {
+	l.mu.Lock()
+	done := l.done
+	l.mu.Unlock()
+
+	if done == nil {
+		return ErrServerNotStarted
+	}
+
+	<-done
+
+	return l.serveErr
 }
 
 func (l *listener) Stop() error {
-	l.healthcheck.SetServingStatus("", healthgrpc.HealthCheckResponse_NOT_SERVING)
+	return l.shutdown(true)
+}
 
-	log.Debugf("stopping gRPC server gracefully...")
-	l.server.GracefulStop()
+// shutdown stops the server once, and returns the error of the first stop to every caller.
+// Without preStop, the server keeps reporting that it is serving and stops without the pre-stop delay:
+// either it failed and no longer accepts requests, or it was upgraded and the new process
+// serves the requests on the same socket.
+func (l *listener) shutdown(preStop bool) error {
+	l.stopOnce.Do(func() {
+		l.stopErr = l.stop(preStop)
+	})
+	return l.stopErr
+}
 
-	time.Sleep(1 * time.Second)
+func (l *listener) stop(preStop bool) error {
+	if preStop {
+		l.setServingStatus(healthgrpc.HealthCheckResponse_NOT_SERVING)
 
-	log.Debugf("stopping gRPC server...")
-	l.server.Stop()
+		if l.preStopDelay > 0 {
+			l.logf(LevelDebug, "waiting %s before stopping gRPC server...", l.preStopDelay)
+			time.Sleep(l.preStopDelay)
+		}
+	}
 
-	return nil
+	if l.reloader != nil {
+		l.reloader.close()
+	}
+
+	l.logf(LevelDebug, "stopping gRPC server gracefully...")
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		l.server.GracefulStop()
+	}()
+
+	var drainTimeout <-chan time.Time
+	if l.drainTimeout > 0 {
+		timer := time.NewTimer(l.drainTimeout)
+		defer timer.Stop()
+		drainTimeout = timer.C
+	}
+
+	select {
+	case <-stopped:
+		return nil
+	case <-drainTimeout:
+		interrupted := atomic.LoadInt64(&l.activeRequests)
+
+		l.logf(LevelDebug, "stopping gRPC server...")
+		// GracefulStop can hold the server lock until the interrupted handlers return,
+		// so the forced stop must not block the caller
+		go l.server.Stop()
+
+		return &DrainTimeoutError{
+			Timeout:     l.drainTimeout,
+			Interrupted: interrupted,
+		}
+	}
+}
+
+func (l *listener) setServingStatus(servingStatus healthgrpc.HealthCheckResponse_ServingStatus) {
+	if l.healthcheck != nil {
+		l.healthcheck.SetServingStatus("", servingStatus)
+	}
+}
+
+func (l *listener) logf(level Level, format string, args ...interface{}) {
+	logf(context.Background(), l.logger, level, format, args...)
 }
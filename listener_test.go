@@ -0,0 +1,314 @@
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func startTestServer(
+	t *testing.T,
+	opts ...Option,
+) (
+	mockServer *internal.MockTestServiceServer,
+	cc *grpc.ClientConn,
+	cleanup func(),
+) {
+	return startTestServerWithCredentials(t, insecure.NewCredentials(), opts...)
+}
+
+func startTestServerWithCredentials(
+	t *testing.T,
+	creds credentials.TransportCredentials,
+	opts ...Option,
+) (
+	mockServer *internal.MockTestServiceServer,
+	cc *grpc.ClientConn,
+	cleanup func(),
+) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server, err := NewServer(append([]Option{WithListener(tcpListener)}, opts...)...)
+	assert.Nil(t, err)
+
+	mockServer = &internal.MockTestServiceServer{}
+	internal.RegisterTestServiceServer(server.GetServer(), mockServer)
+
+	server.Start()
+
+	cc, err = grpc.Dial(tcpListener.Addr().String(), grpc.WithTransportCredentials(creds))
+	assert.Nil(t, err)
+
+	cleanup = func() {
+		err := cc.Close()
+		assert.Nil(t, err)
+		err = server.Stop()
+		assert.Nil(t, err)
+	}
+
+	return mockServer, cc, cleanup
+}
+
+// inputWithValue matches requests by value, ignoring the internal state of the message,
+// such as the size cached by proto.Size.
+func inputWithValue(value string) interface{} {
+	return mock.MatchedBy(func(input *internal.Input) bool {
+		return input.GetValue() == value
+	})
+}
+
+func TestNewServer(t *testing.T) {
+	t.Run("serves the health service", func(t *testing.T) {
+		_, cc, cleanup := startTestServer(t)
+		defer cleanup()
+
+		res, err := healthgrpc.NewHealthClient(cc).Check(context.Background(), &healthgrpc.HealthCheckRequest{}, grpc.WaitForReady(true))
+
+		assert.Nil(t, err)
+		assert.Equal(t, healthgrpc.HealthCheckResponse_SERVING, res.Status)
+	})
+
+	t.Run("health service can be disabled", func(t *testing.T) {
+		_, cc, cleanup := startTestServer(t, WithHealth(false))
+		defer cleanup()
+
+		_, err := healthgrpc.NewHealthClient(cc).Check(context.Background(), &healthgrpc.HealthCheckRequest{}, grpc.WaitForReady(true))
+
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+	})
+
+	t.Run("registers interceptors", func(t *testing.T) {
+		mockServer, cc, cleanup := startTestServer(
+			t,
+			WithUnaryInterceptors(StatusInterceptor),
+			WithStreamInterceptors(StatusStreamInterceptor),
+		)
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("random error"))
+		mockServer.On("Stream", mock.Anything).Return(fmt.Errorf("random error"))
+
+		client := internal.NewTestServiceClient(cc)
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Equal(t, codes.Internal, status.Code(err))
+
+		stream, err := client.Stream(context.Background())
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.Internal, status.Code(err))
+	})
+
+	t.Run("applies server options", func(t *testing.T) {
+		_, cc, cleanup := startTestServer(t, WithServerOptions(grpc.MaxRecvMsgSize(16)))
+		defer cleanup()
+
+		_, err := healthgrpc.NewHealthClient(cc).Check(
+			context.Background(),
+			&healthgrpc.HealthCheckRequest{Service: "a service name that is longer than sixteen bytes"},
+			grpc.WaitForReady(true),
+		)
+
+		assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := NewServer(WithPort(70000))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithListener(nil))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestListen(t *testing.T) {
+	t.Run("returns the bind error", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer tcpListener.Close()
+
+		server, err := NewServer(WithPort(tcpListener.Addr().(*net.TCPAddr).Port))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.NotNil(t, err)
+
+		err = server.Wait()
+		assert.ErrorIs(t, err, ErrServerNotStarted)
+	})
+
+	t.Run("cannot be started twice", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		err = server.Listen()
+		assert.ErrorIs(t, err, ErrServerStarted)
+	})
+
+	t.Run("wait returns nil after stop", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+
+		err = server.Stop()
+		assert.Nil(t, err)
+
+		err = server.Wait()
+		assert.Nil(t, err)
+	})
+
+	t.Run("wait returns serve failures", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		err = tcpListener.Close()
+		assert.Nil(t, err)
+
+		err = server.Wait()
+		assert.NotNil(t, err)
+	})
+	t.Run("reports the bound address", func(t *testing.T) {
+		server, err := NewServer(WithAddress("tcp", "127.0.0.1:0"))
+		assert.Nil(t, err)
+
+		assert.Nil(t, server.Addr())
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		addr, ok := server.Addr().(*net.TCPAddr)
+		if assert.True(t, ok) {
+			assert.NotEqual(t, 0, addr.Port)
+		}
+
+		err = checkHealth(server.Addr().String(), insecure.NewCredentials())
+		assert.Nil(t, err)
+	})
+
+	t.Run("listens on unix sockets", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "grpc")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		socket := filepath.Join(dir, "grpc.sock")
+
+		server, err := NewServer(WithAddress("unix", socket), WithSocketMode(0o660))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+
+		info, err := os.Stat(socket)
+		assert.Nil(t, err)
+		assert.Equal(t, os.FileMode(0o660), info.Mode().Perm())
+
+		err = checkHealth("unix://"+socket, insecure.NewCredentials())
+		assert.Nil(t, err)
+
+		err = server.Stop()
+		assert.Nil(t, err)
+
+		_, err = os.Stat(socket)
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+
+	t.Run("removes stale unix sockets", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "grpc")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		socket := filepath.Join(dir, "grpc.sock")
+
+		stale, err := net.Listen("unix", socket)
+		assert.Nil(t, err)
+		// leave the socket file behind, as a crashed process would
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+
+		server, err := NewServer(WithAddress("unix", socket))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		err = checkHealth("unix://"+socket, insecure.NewCredentials())
+		assert.Nil(t, err)
+	})
+
+	t.Run("does not remove unix sockets in use", func(t *testing.T) {
+		dir, err := os.MkdirTemp("", "grpc")
+		assert.Nil(t, err)
+		defer os.RemoveAll(dir)
+		socket := filepath.Join(dir, "grpc.sock")
+
+		inUse, err := net.Listen("unix", socket)
+		assert.Nil(t, err)
+		defer inUse.Close()
+
+		server, err := NewServer(WithAddress("unix", socket))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.NotNil(t, err)
+	})
+
+	t.Run("does not remove other files", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "grpc.sock")
+		err := os.WriteFile(file, nil, 0o600)
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithAddress("unix", file))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.NotNil(t, err)
+
+		_, err = os.Stat(file)
+		assert.Nil(t, err)
+	})
+
+	t.Run("rejects invalid addresses", func(t *testing.T) {
+		_, err := NewServer(WithAddress("udp", ":40051"))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithAddress("unix", ""))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithSocketMode(os.ModeDir | 0o700))
+		assert.NotNil(t, err)
+	})
+}
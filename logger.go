@@ -0,0 +1,66 @@
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Level is the severity of a log record.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// Fields are the structured fields of a log record.
+type Fields map[string]interface{}
+
+// Logger writes the log records of the server and of the interceptors.
+//
+// Use NewLogrusLogger or NewSlogLogger to adapt an existing logger,
+// and pass it to the server with WithLogger.
+type Logger interface {
+	// Enabled reports whether records with the given level are written.
+	Enabled(ctx context.Context, level Level) bool
+	// Log writes a record with the given level, message and fields.
+	Log(ctx context.Context, level Level, msg string, fields Fields)
+	// With returns a logger that adds the given fields to all records.
+	With(fields Fields) Logger
+}
+
+// defaultLogger is used when no logger is set, and logs with the standard logger of logrus.
+var defaultLogger = NewLogrusLogger(log.StandardLogger())
+
+type loggerKey struct{}
+
+// ContextWithLogger returns a context that carries the given logger,
+// e.g. to add request-scoped fields in an interceptor:
+//
+//	ctx = grpc_server.ContextWithLogger(ctx, grpc_server.LoggerFromContext(ctx).With(fields))
+func ContextWithLogger(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns the logger of a request.
+//
+// Servers store their logger in the context of each request,
+// so that handlers and interceptors log with it.
+// It returns the standard logger of logrus if the context carries no logger.
+func LoggerFromContext(ctx context.Context) Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(Logger); ok {
+		return logger
+	}
+	return defaultLogger
+}
+
+// logf writes a record without fields, formatting the message like fmt.Sprintf.
+func logf(ctx context.Context, logger Logger, level Level, format string, args ...interface{}) {
+	if logger.Enabled(ctx, level) {
+		logger.Log(ctx, level, fmt.Sprintf(format, args...), nil)
+	}
+}
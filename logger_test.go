@@ -0,0 +1,101 @@
+package grpc_server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLogrusLogger(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(log.InfoLevel)
+
+	l := NewLogrusLogger(logger).With(Fields{"service": "payments"})
+
+	assert.False(t, l.Enabled(context.Background(), LevelDebug))
+	assert.True(t, l.Enabled(context.Background(), LevelWarn))
+
+	l.Log(context.Background(), LevelWarn, "something happened", Fields{"attempt": 2})
+
+	entry := hook.LastEntry()
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, log.WarnLevel, entry.Level)
+		assert.Equal(t, "something happened", entry.Message)
+		assert.Equal(t, log.Fields{"service": "payments", "attempt": 2}, entry.Data)
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+
+	l := NewSlogLogger(logger).With(Fields{"service": "payments"})
+
+	assert.False(t, l.Enabled(context.Background(), LevelDebug))
+	assert.True(t, l.Enabled(context.Background(), LevelError))
+
+	l.Log(context.Background(), LevelError, "something happened", Fields{"attempt": 2})
+
+	var record map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &record)
+	assert.Nil(t, err)
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "something happened", record["msg"])
+	assert.Equal(t, "payments", record["service"])
+	assert.Equal(t, float64(2), record["attempt"])
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	t.Run("defaults to the standard logger of logrus", func(t *testing.T) {
+		assert.Equal(t, defaultLogger, LoggerFromContext(context.Background()))
+	})
+
+	t.Run("returns the logger of the context", func(t *testing.T) {
+		logger := NewSlogLogger(slog.Default())
+
+		ctx := ContextWithLogger(context.Background(), logger)
+		assert.Equal(t, logger, LoggerFromContext(ctx))
+	})
+
+	t.Run("returns the logger of the server in handlers and interceptors", func(t *testing.T) {
+		logrusLogger, hook := test.NewNullLogger()
+		logger := NewLogrusLogger(logrusLogger)
+
+		mockServer, cc, cleanup := startTestServer(t,
+			WithLogger(logger),
+			WithUnaryInterceptors(ValidationInterceptor, RecoverInterceptor),
+		)
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			ctx := args.Get(0).(context.Context)
+			assert.Equal(t, logger, LoggerFromContext(ctx))
+			panic("something went wrong")
+		})
+
+		_, err := internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Equal(t, codes.Unknown, status.Code(err))
+
+		// the panic is logged with the logger of the server
+		entry := hook.LastEntry()
+		if assert.NotNil(t, entry) {
+			assert.Equal(t, "recovered a panic on /internal.TestService/Endpoint: something went wrong", entry.Message)
+			assert.Contains(t, entry.Data, "stack_trace")
+		}
+	})
+
+	t.Run("rejects a nil logger", func(t *testing.T) {
+		_, err := NewServer(WithLogger(nil))
+		assert.NotNil(t, err)
+	})
+}
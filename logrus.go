@@ -0,0 +1,42 @@
+package grpc_server
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type logrusLogger struct {
+	entry *log.Entry
+}
+
+// NewLogrusLogger creates a logger that writes to the given logrus logger.
+// This is the default logger, writing to the standard logger of logrus.
+func NewLogrusLogger(logger *log.Logger) Logger {
+	return &logrusLogger{entry: log.NewEntry(logger)}
+}
+
+func (l *logrusLogger) Enabled(ctx context.Context, level Level) bool {
+	return l.entry.Logger.IsLevelEnabled(level.logrusLevel())
+}
+
+func (l *logrusLogger) Log(ctx context.Context, level Level, msg string, fields Fields) {
+	l.entry.WithContext(ctx).WithFields(log.Fields(fields)).Log(level.logrusLevel(), msg)
+}
+
+func (l *logrusLogger) With(fields Fields) Logger {
+	return &logrusLogger{entry: l.entry.WithFields(log.Fields(fields))}
+}
+
+func (l Level) logrusLevel() log.Level {
+	switch l {
+	case LevelDebug:
+		return log.DebugLevel
+	case LevelInfo:
+		return log.InfoLevel
+	case LevelWarn:
+		return log.WarnLevel
+	default:
+		return log.ErrorLevel
+	}
+}
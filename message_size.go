@@ -0,0 +1,118 @@
+package grpc_server
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/proto"
+)
+
+// messageMetrics track the size and number of messages.
+type messageMetrics struct {
+	messageSize    *prometheus.HistogramVec
+	messagesPerRPC *prometheus.HistogramVec
+}
+
+func newMessageMetrics(config *metricsConfig, subsystem string, prefix string, labels []string) messageMetrics {
+	labels = append(labels[:len(labels):len(labels)], "direction")
+
+	return messageMetrics{
+		messageSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.namespace,
+			Subsystem: subsystem,
+			Name:      prefix + "message_size_bytes",
+			Help:      "Size of the gRPC messages sent and received, in bytes",
+			// from 64 bytes to 16MB
+			Buckets:     prometheus.ExponentialBuckets(64, 4, 10),
+			ConstLabels: config.constLabels,
+		}, labels),
+		messagesPerRPC: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.namespace,
+			Subsystem: subsystem,
+			Name:      prefix + "messages_per_rpc",
+			Help:      "Number of messages sent and received on each gRPC stream",
+			// from 1 to 2048 messages
+			Buckets:     prometheus.ExponentialBuckets(1, 2, 12),
+			ConstLabels: config.constLabels,
+		}, labels),
+	}
+}
+
+func (c *messageMetrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{c.messageSize, c.messagesPerRPC}
+}
+
+// messageSize returns the size of a protobuf message in bytes, or -1 for other messages.
+func messageSize(msg interface{}) int {
+	message, ok := msg.(proto.Message)
+	if !ok {
+		return -1
+	}
+	return proto.Size(message)
+}
+
+// messageSizes holds the size of the request and the response of a unary RPC,
+// so that the interceptors that report them compute each size once.
+// The server stores it in the context of each unary request.
+type messageSizes struct {
+	request     int
+	response    int
+	hasRequest  bool
+	hasResponse bool
+}
+
+type messageSizesKey struct{}
+
+// messageSizesFromContext returns the message sizes of a unary request,
+// or nil if they are not stored in the context.
+func messageSizesFromContext(ctx context.Context) *messageSizes {
+	sizes, _ := ctx.Value(messageSizesKey{}).(*messageSizes)
+	return sizes
+}
+
+// requestSize returns the size of the request, computing it on the first call.
+func (s *messageSizes) requestSize(req interface{}) int {
+	if s == nil {
+		return messageSize(req)
+	}
+	if !s.hasRequest {
+		s.request, s.hasRequest = messageSize(req), true
+	}
+	return s.request
+}
+
+// responseSize returns the size of the response, computing it on the first call.
+func (s *messageSizes) responseSize(resp interface{}) int {
+	if s == nil {
+		return messageSize(resp)
+	}
+	if !s.hasResponse {
+		s.response, s.hasResponse = messageSize(resp), true
+	}
+	return s.response
+}
+
+func (m *prometheusRecorder) observeMessageSize(rpc RPCInfo, direction string, size int) {
+	if size < 0 {
+		return
+	}
+
+	labels := m.labels(rpc)
+	labels["direction"] = direction
+	m.messageSize.With(labels).Observe(float64(size))
+}
+
+func (m *prometheusRecorder) MessagesPerRPC(ctx context.Context, rpc RPCInfo, received, sent int) {
+	// the number of messages is only interesting on streams
+	if rpc.Type == unaryRPC {
+		return
+	}
+
+	labels := m.labels(rpc)
+
+	labels["direction"] = "sent"
+	m.messagesPerRPC.With(labels).Observe(float64(sent))
+
+	labels["direction"] = "received"
+	m.messagesPerRPC.With(labels).Observe(float64(received))
+}
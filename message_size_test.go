@@ -0,0 +1,136 @@
+package grpc_server
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMessageSizeMetrics(t *testing.T) {
+	t.Run("records unary message sizes", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		input := &internal.Input{Value: "Hello"}
+		output := &internal.Output{Value: "a longer response"}
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(output, nil)
+
+		_, err = client.Endpoint(context.Background(), input)
+		assert.Nil(t, err)
+
+		received := histogram(t, metrics.Collectors(), "grpc_request_message_size_bytes", prometheus.Labels{"direction": "received"})
+		assert.Equal(t, uint64(1), received.GetSampleCount())
+		assert.Equal(t, float64(proto.Size(input)), received.GetSampleSum())
+
+		sent := histogram(t, metrics.Collectors(), "grpc_request_message_size_bytes", prometheus.Labels{"direction": "sent"})
+		assert.Equal(t, uint64(1), sent.GetSampleCount())
+		assert.Equal(t, float64(proto.Size(output)), sent.GetSampleSum())
+
+		// messages per RPC are only recorded on streams
+		assert.Equal(t, 0, testutil.CollectAndCount(prometheusRecorderOf(metrics).messagesPerRPC))
+	})
+
+	t.Run("records stream message sizes and counts", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServerWithOptions(t, grpc.StreamInterceptor(metrics.StreamInterceptor()))
+		defer cleanup()
+
+		mockServer.On("Stream", mock.Anything).Run(func(args mock.Arguments) {
+			stream := args.Get(0).(internal.TestService_StreamServer)
+			for {
+				input, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				_ = stream.Send(&internal.Output{Value: input.Value})
+				_ = stream.Send(&internal.Output{Value: input.Value})
+			}
+		}).Return(nil)
+
+		stream, err := client.Stream(context.Background())
+		assert.Nil(t, err)
+		for i := 0; i < 3; i++ {
+			assert.Nil(t, stream.Send(&internal.Input{Value: "Hello"}))
+		}
+		assert.Nil(t, stream.CloseSend())
+		for {
+			if _, err = stream.Recv(); err != nil {
+				break
+			}
+		}
+		assert.Equal(t, io.EOF, err)
+
+		assert.Eventually(t, func() bool {
+			return testutil.CollectAndCount(prometheusRecorderOf(metrics).messagesPerRPC) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		receivedSizes := histogram(t, metrics.Collectors(), "grpc_request_message_size_bytes", prometheus.Labels{"direction": "received"})
+		assert.Equal(t, uint64(3), receivedSizes.GetSampleCount())
+		assert.Equal(t, float64(3*proto.Size(&internal.Input{Value: "Hello"})), receivedSizes.GetSampleSum())
+
+		sentSizes := histogram(t, metrics.Collectors(), "grpc_request_message_size_bytes", prometheus.Labels{"direction": "sent"})
+		assert.Equal(t, uint64(6), sentSizes.GetSampleCount())
+
+		received := histogram(t, metrics.Collectors(), "grpc_request_messages_per_rpc", prometheus.Labels{"direction": "received"})
+		assert.Equal(t, uint64(1), received.GetSampleCount())
+		assert.Equal(t, 3.0, received.GetSampleSum())
+
+		sent := histogram(t, metrics.Collectors(), "grpc_request_messages_per_rpc", prometheus.Labels{"direction": "sent"})
+		assert.Equal(t, uint64(1), sent.GetSampleCount())
+		assert.Equal(t, 6.0, sent.GetSampleSum())
+	})
+
+	t.Run("follows the standard metric names", func(t *testing.T) {
+		metrics, err := NewMetrics(WithStandardMetricNames())
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		h := histogram(t, metrics.Collectors(), "grpc_server_message_size_bytes", prometheus.Labels{"grpc_method": "Endpoint", "direction": "received"})
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+	})
+}
+
+func TestMessageSizes(t *testing.T) {
+	t.Run("computes each size once", func(t *testing.T) {
+		sizes := &messageSizes{}
+		req := &internal.Input{Value: "Hello"}
+		resp := &internal.Output{Value: "World!"}
+
+		assert.Equal(t, 7, sizes.requestSize(req))
+		assert.Equal(t, 8, sizes.responseSize(resp))
+
+		req.Value = "Hello, World"
+		resp.Value = ""
+		assert.Equal(t, 7, sizes.requestSize(req))
+		assert.Equal(t, 8, sizes.responseSize(resp))
+	})
+
+	t.Run("computes the sizes without a cache", func(t *testing.T) {
+		sizes := messageSizesFromContext(context.Background())
+
+		assert.Nil(t, sizes)
+		assert.Equal(t, 7, sizes.requestSize(&internal.Input{Value: "Hello"}))
+		assert.Equal(t, -1, sizes.responseSize("World"))
+	})
+}
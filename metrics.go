@@ -2,44 +2,238 @@ package grpc_server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
 )
 
-func NewMetricsInterceptor(excluded ...string) grpc.UnaryServerInterceptor {
-	ignoredEndpoints := make(map[string]bool)
-	for _, endpoint := range excluded {
-		ignoredEndpoints[endpoint] = true
+// Metrics collects metrics on the requests served by a gRPC server.
+//
+// Create it with NewMetrics and pass it to the server with WithMetrics,
+// so that each server owns its metrics.
+type Metrics struct {
+	ignoredEndpoints map[string]bool
+	recorder         Recorder
+
+	// namespace and constLabels are shared with the TLS metrics of the server
+	namespace   string
+	constLabels prometheus.Labels
+}
+
+// MetricsOption configures the metrics created by NewMetrics.
+type MetricsOption func(*metricsConfig) error
+
+type metricsConfig struct {
+	namespace   string
+	subsystem   string
+	constLabels prometheus.Labels
+	registerer  prometheus.Registerer
+	excluded    []string
+	standard    bool
+
+	buckets            []float64
+	methodBuckets      map[string][]float64
+	nativeBucketFactor float64
+
+	exemplar ExemplarFunc
+
+	recorder Recorder
+}
+
+func defaultMetricsConfig() *metricsConfig {
+	return &metricsConfig{
+		namespace: "grpc",
+		exemplar:  TraceExemplar,
+	}
+}
+
+// WithMetricsNamespace sets the namespace of the metric names. The default is "grpc".
+func WithMetricsNamespace(namespace string) MetricsOption {
+	return func(c *metricsConfig) error {
+		c.namespace = namespace
+		return nil
+	}
+}
+
+// WithMetricsSubsystem sets the subsystem of the metric names,
+// which is added between the namespace and the name. There is no subsystem by default.
+func WithMetricsSubsystem(subsystem string) MetricsOption {
+	return func(c *metricsConfig) error {
+		c.subsystem = subsystem
+		return nil
+	}
+}
+
+// WithMetricsConstLabels adds labels with a fixed value to all metrics,
+// e.g. to tell apart the metrics of two servers running in the same process.
+func WithMetricsConstLabels(labels prometheus.Labels) MetricsOption {
+	return func(c *metricsConfig) error {
+		c.constLabels = labels
+		return nil
+	}
+}
+
+// WithStandardMetricNames makes the metrics follow the names and labels
+// of the grpc_server_* metrics of go-grpc-prometheus, so that existing dashboards
+// and alerts can be reused:
+//
+//   - grpc_server_started_total
+//   - grpc_server_handled_total
+//   - grpc_server_handling_seconds
+//   - grpc_server_msg_received_total
+//   - grpc_server_msg_sent_total
+//   - grpc_server_application_errors_total
+//
+// The metrics have the grpc_type, grpc_service and grpc_method labels,
+// and the handled and application error counters have the grpc_code label.
+func WithStandardMetricNames() MetricsOption {
+	return func(c *metricsConfig) error {
+		c.standard = true
+		return nil
+	}
+}
+
+// WithMetricsRegisterer registers the metrics in the given registerer when they are created.
+func WithMetricsRegisterer(registerer prometheus.Registerer) MetricsOption {
+	return func(c *metricsConfig) error {
+		if registerer == nil {
+			return errors.New("metrics registerer must not be nil")
+		}
+		c.registerer = registerer
+		return nil
+	}
+}
+
+// WithExcludedMethods excludes the given methods from the metrics,
+// e.g. the health check method.
+func WithExcludedMethods(methods ...string) MetricsOption {
+	return func(c *metricsConfig) error {
+		c.excluded = append(c.excluded, methods...)
+		return nil
+	}
+}
+
+// WithRecorder records the metrics with the given recorder, instead of prometheus.
+// The options that configure the prometheus metrics are ignored.
+func WithRecorder(recorder Recorder) MetricsOption {
+	return func(c *metricsConfig) error {
+		if recorder == nil {
+			return errors.New("metrics recorder must not be nil")
+		}
+		c.recorder = recorder
+		return nil
+	}
+}
+
+// NewMetrics creates the metrics for a gRPC server.
+// The metrics are recorded with prometheus, unless another recorder is set with WithRecorder.
+//
+// It returns an error if an option is invalid,
+// or if the metrics cannot be registered in the registerer.
+func NewMetrics(opts ...MetricsOption) (*Metrics, error) {
+	config := defaultMetricsConfig()
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	m := newMetrics(config)
+
+	if config.registerer != nil {
+		collectors := m.Collectors()
+		for i, collector := range collectors {
+			if err := config.registerer.Register(collector); err != nil {
+				// the metrics are not used, so they must not stay registered
+				for _, registered := range collectors[:i] {
+					config.registerer.Unregister(registered)
+				}
+				return nil, err
+			}
+		}
 	}
 
-	if requestTimesMonitor == nil {
-		requestTimesMonitor = prometheus.NewHistogramVec(prometheus.HistogramOpts{
-			Subsystem: "grpc",
-			Name:      "request_time_ms",
-			Help:      "Time to serve gRPC requests in milliseconds",
-			Buckets:   prometheus.ExponentialBuckets(16, 2, 10),
-		}, []string{"endpoint"})
+	return m, nil
+}
+
+func newMetrics(config *metricsConfig) *Metrics {
+	recorder := config.recorder
+	if recorder == nil {
+		recorder = newPrometheusRecorder(config)
 	}
 
-	if requestCounter == nil {
-		requestCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-			Namespace: "grpc",
-			Name:      "request_count_total",
-			Help:      "Counter for received gRPC requests",
-		}, []string{"endpoint"})
+	return &Metrics{
+		ignoredEndpoints: ignoredEndpointSet(config.excluded),
+		recorder:         recorder,
+		namespace:        config.namespace,
+		constLabels:      config.constLabels,
+	}
+}
+
+// Collectors returns the prometheus collectors of the metrics.
+// It returns the collectors of the recorder if it has a Collectors method,
+// and nil otherwise.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	if collector, ok := m.recorder.(interface {
+		Collectors() []prometheus.Collector
+	}); ok {
+		return collector.Collectors()
 	}
+	return nil
+}
+
+var (
+	defaultMetricsMu       sync.Mutex
+	defaultMetricsInstance *Metrics
+)
+
+// defaultMetrics returns the metrics shared by the interceptors
+// created with NewMetricsInterceptor and NewErrorInterceptor.
+func defaultMetrics() *Metrics {
+	defaultMetricsMu.Lock()
+	defer defaultMetricsMu.Unlock()
 
-	if errorCounter == nil {
-		errorCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-			Namespace: "grpc",
-			Name:      "request_error_count_total",
-			Help:      "Counter for failed gRPC requests",
-		}, []string{"endpoint"})
+	if defaultMetricsInstance == nil {
+		defaultMetricsInstance = newMetrics(defaultMetricsConfig())
 	}
+	return defaultMetricsInstance
+}
 
+// NewMetricsInterceptor creates an interceptor that collects metrics on requests,
+// ignoring the given endpoints.
+//
+// The metrics are shared by all servers in the process.
+// Use NewMetrics and WithMetrics to create metrics owned by a single server.
+func NewMetricsInterceptor(excluded ...string) grpc.UnaryServerInterceptor {
+	return defaultMetrics().unaryInterceptor(ignoredEndpointSet(excluded))
+}
+
+// NewMetricsStreamInterceptor creates the stream counterpart of NewMetricsInterceptor.
+//
+// Besides the request metrics, it counts the messages sent and received on each stream.
+func NewMetricsStreamInterceptor(excluded ...string) grpc.StreamServerInterceptor {
+	return defaultMetrics().streamInterceptor(ignoredEndpointSet(excluded))
+}
+
+// UnaryInterceptor returns an interceptor that collects metrics on requests.
+//
+// Servers created with WithMetrics register it automatically.
+func (m *Metrics) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return m.unaryInterceptor(m.ignoredEndpoints)
+}
+
+// StreamInterceptor returns the stream counterpart of UnaryInterceptor.
+func (m *Metrics) StreamInterceptor() grpc.StreamServerInterceptor {
+	return m.streamInterceptor(m.ignoredEndpoints)
+}
+
+func (m *Metrics) unaryInterceptor(ignoredEndpoints map[string]bool) grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
 		req interface{},
@@ -50,28 +244,138 @@ func NewMetricsInterceptor(excluded ...string) grpc.UnaryServerInterceptor {
 			return handler(ctx, req)
 		}
 
-		start := time.Now()
+		rpc := newRPCInfo(info.FullMethod, unaryRPC)
 
-		requestCounter.With(prometheus.Labels{"endpoint": info.FullMethod}).Inc()
+		sizes := messageSizesFromContext(ctx)
 
-		defer func() {
-			requestTimesMonitor.
-				With(prometheus.Labels{"endpoint": info.FullMethod}).
-				Observe(float64(time.Now().Sub(start) / time.Millisecond))
-		}()
+		start := time.Now()
+		m.recorder.RPCStarted(ctx, rpc)
+		m.recorder.MessageReceived(ctx, rpc, sizes.requestSize(req))
 
 		resp, err = handler(ctx, req)
 
+		sent := 0
 		if err == nil {
-			return resp, nil
+			sent = 1
+			m.recorder.MessageSent(ctx, rpc, sizes.responseSize(resp))
 		}
+		m.recorder.MessagesPerRPC(ctx, rpc, 1, sent)
+		m.recorder.RPCHandled(ctx, rpc, status.Code(err), time.Since(start))
 
-		errorCounter.With(prometheus.Labels{"endpoint": info.FullMethod}).Inc()
+		if err == nil {
+			return resp, nil
+		}
 
-		log.
-			WithField("request", req).
-			Errorf("request failed on %s: %v", info.FullMethod, err)
+		LoggerFromContext(ctx).Log(ctx, LevelError, fmt.Sprintf("request failed on %s: %v", info.FullMethod, err), Fields{
+			"request": redactorFromContext(ctx).Redact(req),
+		})
 
 		return nil, err
 	}
 }
+
+func (m *Metrics) streamInterceptor(ignoredEndpoints map[string]bool) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if ignoredEndpoints[info.FullMethod] {
+			return handler(srv, ss)
+		}
+
+		ctx := ss.Context()
+		rpc := newRPCInfo(info.FullMethod, streamRPCType(info))
+
+		start := time.Now()
+		m.recorder.RPCStarted(ctx, rpc)
+
+		stream := newCountingServerStream(ss, rpc, m.recorder)
+		err := handler(srv, stream)
+
+		m.recorder.MessagesPerRPC(ctx, rpc, int(atomic.LoadInt64(&stream.received)), int(atomic.LoadInt64(&stream.sent)))
+		m.recorder.RPCHandled(ctx, rpc, status.Code(err), time.Since(start))
+
+		if err == nil {
+			return nil
+		}
+
+		logf(ctx, LoggerFromContext(ctx), LevelError, "stream failed on %s: %v", info.FullMethod, err)
+
+		return err
+	}
+}
+
+// countingServerStream counts the messages received and sent on a stream, and their size.
+type countingServerStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	rpc      RPCInfo
+	recorder Recorder
+
+	sent          int64
+	received      int64
+	sentBytes     int64
+	receivedBytes int64
+}
+
+type countingServerStreamKey struct{}
+
+// newCountingServerStream wraps a stream to count its messages,
+// recording each one with the recorder if it is not nil.
+// The stream is stored in its context, so that the access log reuses its counts.
+func newCountingServerStream(ss grpc.ServerStream, rpc RPCInfo, recorder Recorder) *countingServerStream {
+	s := &countingServerStream{ServerStream: ss, rpc: rpc, recorder: recorder}
+	s.ctx = context.WithValue(ss.Context(), countingServerStreamKey{}, s)
+	return s
+}
+
+// countingServerStreamFromContext returns the stream that counts the messages
+// of the stream with the given context, if any.
+func countingServerStreamFromContext(ctx context.Context) (*countingServerStream, bool) {
+	s, ok := ctx.Value(countingServerStreamKey{}).(*countingServerStream)
+	return s, ok
+}
+
+func (s *countingServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *countingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		size := messageSize(m)
+		atomic.AddInt64(&s.sent, 1)
+		if size > 0 {
+			atomic.AddInt64(&s.sentBytes, int64(size))
+		}
+		if s.recorder != nil {
+			s.recorder.MessageSent(s.ctx, s.rpc, size)
+		}
+	}
+	return err
+}
+
+func (s *countingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		size := messageSize(m)
+		atomic.AddInt64(&s.received, 1)
+		if size > 0 {
+			atomic.AddInt64(&s.receivedBytes, int64(size))
+		}
+		if s.recorder != nil {
+			s.recorder.MessageReceived(s.ctx, s.rpc, size)
+		}
+	}
+	return err
+}
+
+func ignoredEndpointSet(excluded []string) map[string]bool {
+	ignoredEndpoints := make(map[string]bool)
+	for _, endpoint := range excluded {
+		ignoredEndpoints[endpoint] = true
+	}
+	return ignoredEndpoints
+}
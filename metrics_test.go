@@ -2,12 +2,21 @@ package grpc_server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"testing"
+	"time"
 
 	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func TestMetrics(t *testing.T) {
@@ -37,4 +46,359 @@ func TestMetrics(t *testing.T) {
 
 		assert.NotNil(t, err)
 	})
+
+	t.Run("stream metric interceptor works", func(t *testing.T) {
+		client, mockServer, cleanup := setupTestStreamServer(t, NewMetricsStreamInterceptor())
+		defer cleanup()
+
+		ctx := context.Background()
+
+		mockServer.On("Stream", mock.Anything).Return(echoStream)
+
+		stream, err := client.Stream(ctx)
+		assert.Nil(t, err)
+
+		err = stream.Send(&internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		res, err := stream.Recv()
+		assert.Nil(t, err)
+		assert.Equal(t, "Hello", res.Value)
+
+		err = stream.CloseSend()
+		assert.Nil(t, err)
+
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("stream metric interceptor works on error too", func(t *testing.T) {
+		client, mockServer, cleanup := setupTestStreamServer(t, NewMetricsStreamInterceptor())
+		defer cleanup()
+
+		ctx := context.Background()
+
+		mockServer.On("Stream", mock.Anything).Return(fmt.Errorf("random error"))
+
+		stream, err := client.Stream(ctx)
+		assert.Nil(t, err)
+
+		_, err = stream.Recv()
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestNewMetrics(t *testing.T) {
+	t.Run("servers own their metrics", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+		otherMetrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		mockServer, cc, cleanup := startTestServer(t, WithMetrics(metrics))
+		defer cleanup()
+		_, _, otherCleanup := startTestServer(t, WithMetrics(otherMetrics))
+		defer otherCleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+
+		labels := prometheus.Labels{"service": "internal.TestService", "method": "Endpoint"}
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_request_count_total", labels))
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_request_duration_seconds", labels))
+		assert.Equal(t, 0, testutil.CollectAndCount(prometheusRecorderOf(otherMetrics).requestCounter))
+	})
+
+	t.Run("server returns its metrics", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithMetrics(metrics))
+		assert.Nil(t, err)
+
+		assert.ElementsMatch(t, metrics.Collectors(), server.GetMetrics())
+	})
+
+	t.Run("configures names and labels", func(t *testing.T) {
+		metrics, err := NewMetrics(
+			WithMetricsNamespace("app"),
+			WithMetricsSubsystem("api"),
+			WithMetricsConstLabels(prometheus.Labels{"server": "public"}),
+		)
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "app_api_request_count_total", prometheus.Labels{"server": "public"}))
+	})
+
+	t.Run("excludes methods", func(t *testing.T) {
+		metrics, err := NewMetrics(WithExcludedMethods("/internal.TestService/Endpoint"))
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		assert.Equal(t, 0, testutil.CollectAndCount(prometheusRecorderOf(metrics).requestCounter))
+	})
+
+	t.Run("counts application errors", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.ErrorInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, &testApplicationError{message: "not found", grpcCode: codes.NotFound, code: "NOT_FOUND"})
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_request_application_error_count_total", nil))
+	})
+
+	t.Run("registers the metrics", func(t *testing.T) {
+		registry := prometheus.NewPedanticRegistry()
+
+		_, err := NewMetrics(WithMetricsRegisterer(registry))
+		assert.Nil(t, err)
+
+		_, err = NewMetrics(WithMetricsRegisterer(registry))
+		assert.NotNil(t, err)
+
+		_, err = NewMetrics(WithMetricsRegisterer(registry), WithMetricsNamespace("other"))
+		assert.Nil(t, err)
+	})
+
+	t.Run("unregisters the metrics when registration fails", func(t *testing.T) {
+		registerer := &failingRegisterer{failAfter: 2}
+
+		_, err := NewMetrics(WithMetricsRegisterer(registerer))
+		assert.NotNil(t, err)
+		assert.Equal(t, 0, registerer.registered)
+	})
+
+	t.Run("records the status code returned to clients", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		mockServer, cc, cleanup := startTestServer(
+			t,
+			WithMetrics(metrics),
+			WithUnaryInterceptors(StatusInterceptor, metrics.ErrorInterceptor()),
+		)
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, inputWithValue("random")).Return(nil, fmt.Errorf("random error"))
+		mockServer.On("Endpoint", mock.Anything, inputWithValue("missing")).Return(nil, &testApplicationError{message: "not found", grpcCode: codes.NotFound, code: "NOT_FOUND"})
+
+		client := internal.NewTestServiceClient(cc)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "random"}, grpc.WaitForReady(true))
+		assert.Equal(t, codes.Internal, status.Code(err))
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "missing"}, grpc.WaitForReady(true))
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		for _, code := range []string{"Internal", "NotFound"} {
+			labels := prometheus.Labels{"service": "internal.TestService", "method": "Endpoint", "code": code}
+			assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_request_count_total", labels))
+			assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_request_error_count_total", labels))
+		}
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_request_application_error_count_total", prometheus.Labels{"code": "NotFound"}))
+	})
+
+	t.Run("follows the standard metric names", func(t *testing.T) {
+		metrics, err := NewMetrics(WithStandardMetricNames())
+		assert.Nil(t, err)
+
+		mockServer, cc, cleanup := startTestServer(t, WithMetrics(metrics))
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+		mockServer.On("Stream", mock.Anything).Return(echoStream)
+
+		client := internal.NewTestServiceClient(cc)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+
+		stream, err := client.Stream(context.Background(), grpc.WaitForReady(true))
+		assert.Nil(t, err)
+		for i := 0; i < 2; i++ {
+			err = stream.Send(&internal.Input{Value: "Hello"})
+			assert.Nil(t, err)
+			_, err = stream.Recv()
+			assert.Nil(t, err)
+		}
+		err = stream.CloseSend()
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+
+		unary := prometheus.Labels{"grpc_type": "unary", "grpc_service": "internal.TestService", "grpc_method": "Endpoint"}
+		bidi := prometheus.Labels{"grpc_type": "bidi_stream", "grpc_service": "internal.TestService", "grpc_method": "Stream"}
+
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_server_started_total", unary))
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_server_handled_total", prometheus.Labels{"grpc_type": "unary", "grpc_code": "OK"}))
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_server_handling_seconds", unary))
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_server_msg_received_total", unary))
+		assert.Equal(t, float64(1), metricValue(t, metrics.Collectors(), "grpc_server_msg_sent_total", unary))
+
+		assert.Eventually(t, func() bool {
+			return metricValue(t, metrics.Collectors(), "grpc_server_handled_total", prometheus.Labels{"grpc_type": "bidi_stream", "grpc_code": "OK"}) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, float64(2), metricValue(t, metrics.Collectors(), "grpc_server_msg_received_total", bidi))
+		assert.Equal(t, float64(2), metricValue(t, metrics.Collectors(), "grpc_server_msg_sent_total", bidi))
+	})
+}
+
+func TestSplitMethod(t *testing.T) {
+	service, method := splitMethod("/package.Service/Method")
+	assert.Equal(t, "package.Service", service)
+	assert.Equal(t, "Method", method)
+
+	service, method = splitMethod("Method")
+	assert.Equal(t, "unknown", service)
+	assert.Equal(t, "Method", method)
+}
+
+// histogram returns the histogram with the given name and labels.
+func histogram(t *testing.T, collectors []prometheus.Collector, name string, labels prometheus.Labels) *dto.Histogram {
+	return findMetric(t, collectors, name, labels).GetHistogram()
+}
+
+// prometheusRecorderOf returns the Prometheus recorder of the given metrics.
+func prometheusRecorderOf(metrics *Metrics) *prometheusRecorder {
+	return metrics.recorder.(*prometheusRecorder)
+}
+
+func bucketBounds(h *dto.Histogram) []float64 {
+	var bounds []float64
+	for _, bucket := range h.GetBucket() {
+		bounds = append(bounds, bucket.GetUpperBound())
+	}
+	return bounds
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	t.Run("records latency in seconds", func(t *testing.T) {
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).After(2*time.Millisecond).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		h := histogram(t, metrics.Collectors(), "grpc_request_duration_seconds", nil)
+		assert.Equal(t, uint64(1), h.GetSampleCount())
+		assert.Greater(t, h.GetSampleSum(), 0.002)
+		assert.Less(t, h.GetSampleSum(), 1.0)
+		assert.Equal(t, defaultLatencyBuckets, bucketBounds(h))
+	})
+
+	t.Run("uses the configured buckets", func(t *testing.T) {
+		metrics, err := NewMetrics(
+			WithHistogramBuckets(0.001, 0.01, 0.1),
+			WithMethodHistogramBuckets("/internal.TestService/Stream", 1, 10),
+		)
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServerWithOptions(
+			t,
+			grpc.UnaryInterceptor(metrics.UnaryInterceptor()),
+			grpc.StreamInterceptor(metrics.StreamInterceptor()),
+		)
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+		mockServer.On("Stream", mock.Anything).Return(nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		stream, err := client.Stream(context.Background())
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+
+		assert.Eventually(t, func() bool {
+			return testutil.CollectAndCount(prometheusRecorderOf(metrics).requestTime) == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		endpoint := histogram(t, metrics.Collectors(), "grpc_request_duration_seconds", prometheus.Labels{"method": "Endpoint"})
+		assert.Equal(t, []float64{0.001, 0.01, 0.1}, bucketBounds(endpoint))
+
+		streamHistogram := histogram(t, metrics.Collectors(), "grpc_request_duration_seconds", prometheus.Labels{"method": "Stream"})
+		assert.Equal(t, []float64{1, 10}, bucketBounds(streamHistogram))
+	})
+
+	t.Run("supports native histograms", func(t *testing.T) {
+		metrics, err := NewMetrics(WithNativeHistograms(1.1))
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		h := histogram(t, metrics.Collectors(), "grpc_request_duration_seconds", nil)
+		assert.NotNil(t, h.Schema)
+		assert.Equal(t, defaultLatencyBuckets, bucketBounds(h))
+	})
+
+	t.Run("rejects invalid buckets", func(t *testing.T) {
+		_, err := NewMetrics(WithHistogramBuckets())
+		assert.NotNil(t, err)
+
+		_, err = NewMetrics(WithHistogramBuckets(0.1, 0.01))
+		assert.NotNil(t, err)
+
+		_, err = NewMetrics(WithMethodHistogramBuckets("", 0.1))
+		assert.NotNil(t, err)
+
+		_, err = NewMetrics(WithNativeHistograms(1))
+		assert.NotNil(t, err)
+	})
+}
+
+// failingRegisterer fails to register collectors after registering the given number of them.
+type failingRegisterer struct {
+	prometheus.Registerer
+	failAfter  int
+	registered int
+}
+
+func (r *failingRegisterer) Register(prometheus.Collector) error {
+	if r.registered == r.failAfter {
+		return errors.New("registration failed")
+	}
+	r.registered++
+	return nil
+}
+
+func (r *failingRegisterer) Unregister(prometheus.Collector) bool {
+	r.registered--
+	return true
 }
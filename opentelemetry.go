@@ -0,0 +1,164 @@
+package grpc_server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"google.golang.org/grpc/codes"
+)
+
+// instrumentationName identifies this package in OpenTelemetry.
+const instrumentationName = "github.com/moveaxlab/go-grpc-server"
+
+// otelRecorder records metrics with the OpenTelemetry metric API.
+type otelRecorder struct {
+	duration          metric.Float64Histogram
+	requestSize       metric.Int64Histogram
+	responseSize      metric.Int64Histogram
+	requestsPerRPC    metric.Int64Histogram
+	responsesPerRPC   metric.Int64Histogram
+	activeRequests    metric.Int64UpDownCounter
+	applicationErrors metric.Int64Counter
+	queueWait         metric.Float64Histogram
+}
+
+// NewOpenTelemetryRecorder creates a recorder that records metrics with the OpenTelemetry metric API,
+// following the semantic conventions for RPC servers:
+//
+//   - rpc.server.duration
+//   - rpc.server.request.size
+//   - rpc.server.response.size
+//   - rpc.server.requests_per_rpc
+//   - rpc.server.responses_per_rpc
+//
+// The metrics have the rpc.system, rpc.service and rpc.method attributes,
+// and the duration has the rpc.grpc.status_code attribute.
+// The recorder also records rpc.server.active_requests, rpc.server.application_errors
+// and rpc.server.queue_wait, which are not part of the conventions.
+//
+// Pass the recorder to NewMetrics with WithRecorder.
+func NewOpenTelemetryRecorder(provider metric.MeterProvider) (Recorder, error) {
+	if provider == nil {
+		return nil, errors.New("meter provider must not be nil")
+	}
+
+	meter := provider.Meter(instrumentationName, metric.WithSchemaURL(semconv.SchemaURL))
+
+	var r otelRecorder
+	var err error
+
+	if r.duration, err = meter.Float64Histogram(
+		"rpc.server.duration",
+		metric.WithDescription("Measures the duration of inbound RPC."),
+		metric.WithUnit("ms"),
+	); err != nil {
+		return nil, err
+	}
+	if r.requestSize, err = meter.Int64Histogram(
+		"rpc.server.request.size",
+		metric.WithDescription("Measures the size of RPC request messages (uncompressed)."),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if r.responseSize, err = meter.Int64Histogram(
+		"rpc.server.response.size",
+		metric.WithDescription("Measures the size of RPC response messages (uncompressed)."),
+		metric.WithUnit("By"),
+	); err != nil {
+		return nil, err
+	}
+	if r.requestsPerRPC, err = meter.Int64Histogram(
+		"rpc.server.requests_per_rpc",
+		metric.WithDescription("Measures the number of messages received per RPC."),
+		metric.WithUnit("{count}"),
+	); err != nil {
+		return nil, err
+	}
+	if r.responsesPerRPC, err = meter.Int64Histogram(
+		"rpc.server.responses_per_rpc",
+		metric.WithDescription("Measures the number of messages sent per RPC."),
+		metric.WithUnit("{count}"),
+	); err != nil {
+		return nil, err
+	}
+	if r.activeRequests, err = meter.Int64UpDownCounter(
+		"rpc.server.active_requests",
+		metric.WithDescription("Number of RPCs being handled by the server."),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		return nil, err
+	}
+	if r.applicationErrors, err = meter.Int64Counter(
+		"rpc.server.application_errors",
+		metric.WithDescription("Number of RPCs that failed with application errors."),
+		metric.WithUnit("{error}"),
+	); err != nil {
+		return nil, err
+	}
+	if r.queueWait, err = meter.Float64Histogram(
+		"rpc.server.queue_wait",
+		metric.WithDescription("Measures the time RPCs spent waiting for the concurrency limit."),
+		metric.WithUnit("ms"),
+	); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
+
+func rpcAttributes(rpc RPCInfo) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.RPCSystemGRPC,
+		semconv.RPCService(rpc.Service),
+		semconv.RPCMethod(rpc.Method),
+	}
+}
+
+func rpcCodeAttributes(rpc RPCInfo, code codes.Code) []attribute.KeyValue {
+	return append(rpcAttributes(rpc), semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+}
+
+// milliseconds converts a duration to milliseconds, keeping the fractional part.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (r *otelRecorder) RPCStarted(ctx context.Context, rpc RPCInfo) {
+	r.activeRequests.Add(ctx, 1, metric.WithAttributes(rpcAttributes(rpc)...))
+}
+
+func (r *otelRecorder) RPCHandled(ctx context.Context, rpc RPCInfo, code codes.Code, duration time.Duration) {
+	r.activeRequests.Add(ctx, -1, metric.WithAttributes(rpcAttributes(rpc)...))
+	r.duration.Record(ctx, milliseconds(duration), metric.WithAttributes(rpcCodeAttributes(rpc, code)...))
+}
+
+func (r *otelRecorder) MessageReceived(ctx context.Context, rpc RPCInfo, size int) {
+	if size >= 0 {
+		r.requestSize.Record(ctx, int64(size), metric.WithAttributes(rpcAttributes(rpc)...))
+	}
+}
+
+func (r *otelRecorder) MessageSent(ctx context.Context, rpc RPCInfo, size int) {
+	if size >= 0 {
+		r.responseSize.Record(ctx, int64(size), metric.WithAttributes(rpcAttributes(rpc)...))
+	}
+}
+
+func (r *otelRecorder) MessagesPerRPC(ctx context.Context, rpc RPCInfo, received, sent int) {
+	attributes := metric.WithAttributes(rpcAttributes(rpc)...)
+	r.requestsPerRPC.Record(ctx, int64(received), attributes)
+	r.responsesPerRPC.Record(ctx, int64(sent), attributes)
+}
+
+func (r *otelRecorder) ApplicationError(ctx context.Context, rpc RPCInfo, code codes.Code) {
+	r.applicationErrors.Add(ctx, 1, metric.WithAttributes(rpcCodeAttributes(rpc, code)...))
+}
+
+func (r *otelRecorder) QueueWait(ctx context.Context, rpc RPCInfo, wait time.Duration) {
+	r.queueWait.Record(ctx, milliseconds(wait), metric.WithAttributes(rpcAttributes(rpc)...))
+}
@@ -0,0 +1,135 @@
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestOpenTelemetryMetrics(t *testing.T) (*Metrics, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	recorder, err := NewOpenTelemetryRecorder(provider)
+	assert.Nil(t, err)
+
+	metrics, err := NewMetrics(WithRecorder(recorder))
+	assert.Nil(t, err)
+
+	return metrics, reader
+}
+
+func otelMetric(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	var data metricdata.ResourceMetrics
+	err := reader.Collect(context.Background(), &data)
+	assert.Nil(t, err)
+
+	for _, scope := range data.ScopeMetrics {
+		assert.Equal(t, instrumentationName, scope.Scope.Name)
+		for _, m := range scope.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+
+	t.Fatalf("metric %s not found", name)
+	return nil
+}
+
+func TestOpenTelemetryRecorder(t *testing.T) {
+	t.Run("follows the rpc semantic conventions", func(t *testing.T) {
+		metrics, reader := newTestOpenTelemetryMetrics(t)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor())
+		defer cleanup()
+
+		output := &internal.Output{Value: "World"}
+		mockServer.On("Endpoint", mock.Anything, inputWithValue("Hello")).Return(output, nil)
+		mockServer.On("Endpoint", mock.Anything, inputWithValue("fail")).Return(nil, fmt.Errorf("random error"))
+
+		input := &internal.Input{Value: "Hello"}
+		_, err := client.Endpoint(context.Background(), input)
+		assert.Nil(t, err)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "fail"})
+		assert.NotNil(t, err)
+
+		duration := otelMetric(t, reader, "rpc.server.duration").(metricdata.Histogram[float64])
+		if assert.Len(t, duration.DataPoints, 2) {
+			for _, point := range duration.DataPoints {
+				assert.Equal(t, uint64(1), point.Count)
+
+				system, _ := point.Attributes.Value("rpc.system")
+				assert.Equal(t, "grpc", system.AsString())
+				service, _ := point.Attributes.Value("rpc.service")
+				assert.Equal(t, "internal.TestService", service.AsString())
+				method, _ := point.Attributes.Value("rpc.method")
+				assert.Equal(t, "Endpoint", method.AsString())
+				code, ok := point.Attributes.Value("rpc.grpc.status_code")
+				assert.True(t, ok)
+				assert.Contains(t, []int64{int64(codes.OK), int64(codes.Unknown)}, code.AsInt64())
+			}
+		}
+
+		requestSize := otelMetric(t, reader, "rpc.server.request.size").(metricdata.Histogram[int64])
+		if assert.Len(t, requestSize.DataPoints, 1) {
+			assert.Equal(t, uint64(2), requestSize.DataPoints[0].Count)
+		}
+
+		responseSize := otelMetric(t, reader, "rpc.server.response.size").(metricdata.Histogram[int64])
+		if assert.Len(t, responseSize.DataPoints, 1) {
+			assert.Equal(t, uint64(1), responseSize.DataPoints[0].Count)
+			assert.Equal(t, int64(proto.Size(output)), responseSize.DataPoints[0].Sum)
+		}
+
+		responsesPerRPC := otelMetric(t, reader, "rpc.server.responses_per_rpc").(metricdata.Histogram[int64])
+		if assert.Len(t, responsesPerRPC.DataPoints, 1) {
+			assert.Equal(t, uint64(2), responsesPerRPC.DataPoints[0].Count)
+			assert.Equal(t, int64(1), responsesPerRPC.DataPoints[0].Sum)
+		}
+
+		active := otelMetric(t, reader, "rpc.server.active_requests").(metricdata.Sum[int64])
+		if assert.Len(t, active.DataPoints, 1) {
+			assert.Equal(t, int64(0), active.DataPoints[0].Value)
+		}
+
+		// the metrics are not exposed to prometheus
+		assert.Empty(t, metrics.Collectors())
+	})
+
+	t.Run("counts application errors", func(t *testing.T) {
+		metrics, reader := newTestOpenTelemetryMetrics(t)
+
+		client, mockServer, cleanup := setupTestServer(t, metrics.UnaryInterceptor(), metrics.ErrorInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, &testApplicationError{message: "not found", grpcCode: codes.NotFound, code: "NOT_FOUND"})
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.NotNil(t, err)
+
+		applicationErrors := otelMetric(t, reader, "rpc.server.application_errors").(metricdata.Sum[int64])
+		if assert.Len(t, applicationErrors.DataPoints, 1) {
+			assert.Equal(t, int64(1), applicationErrors.DataPoints[0].Value)
+			assert.True(t, applicationErrors.DataPoints[0].Attributes.HasValue(attribute.Key("rpc.grpc.status_code")))
+		}
+	})
+
+	t.Run("requires a meter provider", func(t *testing.T) {
+		_, err := NewOpenTelemetryRecorder(nil)
+		assert.NotNil(t, err)
+
+		_, err = NewMetrics(WithRecorder(nil))
+		assert.NotNil(t, err)
+	})
+}
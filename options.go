@@ -0,0 +1,205 @@
+package grpc_server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Option configures the gRPC server created by NewServer.
+type Option func(*serverConfig) error
+
+type serverConfig struct {
+	port                 int
+	network              string
+	address              string
+	socketMode           os.FileMode
+	socketActivation     bool
+	socketActivationName string
+	listener             net.Listener
+	serverOptions        []grpc.ServerOption
+	unaryInterceptors    []grpc.UnaryServerInterceptor
+	streamInterceptors   []grpc.StreamServerInterceptor
+	health               bool
+	preStopDelay         time.Duration
+	drainTimeout         time.Duration
+	tls                  *tlsOptions
+	metrics              *Metrics
+	tracing              *Tracing
+	accessLog            *AccessLog
+	logger               Logger
+	redactor             *Redactor
+	concurrencyLimit     int
+	upgradeCommand       []string
+	upgradeTimeout       time.Duration
+	upgradeSignals       []os.Signal
+}
+
+func defaultServerConfig() *serverConfig {
+	return &serverConfig{
+		health:         true,
+		drainTimeout:   30 * time.Second,
+		upgradeCommand: os.Args,
+		upgradeTimeout: time.Minute,
+		logger:         defaultLogger,
+		redactor:       defaultRedactor,
+	}
+}
+
+// WithPort sets the TCP port the server listens on.
+func WithPort(port int) Option {
+	return func(c *serverConfig) error {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+		c.port = port
+		return nil
+	}
+}
+
+// WithAddress sets the network and address the server listens on,
+// e.g. ("tcp", "127.0.0.1:40051") or ("unix", "/run/app/grpc.sock").
+// The configured port is ignored.
+//
+// The supported networks are tcp, tcp4, tcp6 and unix.
+// A stale Unix socket file left by a previous process is removed before binding,
+// and the socket file is removed when the server stops.
+func WithAddress(network, address string) Option {
+	return func(c *serverConfig) error {
+		switch network {
+		case "tcp", "tcp4", "tcp6", "unix":
+		default:
+			return fmt.Errorf("unsupported network %q", network)
+		}
+		if network == "unix" && address == "" {
+			return errors.New("unix socket address must not be empty")
+		}
+		c.network = network
+		c.address = address
+		return nil
+	}
+}
+
+// WithSocketMode sets the permissions of the Unix socket file
+// created by the server, e.g. 0o660 to restrict access to a group.
+// It only applies to the unix network set with WithAddress.
+func WithSocketMode(mode os.FileMode) Option {
+	return func(c *serverConfig) error {
+		if mode&^os.ModePerm != 0 {
+			return fmt.Errorf("invalid socket mode %s", mode)
+		}
+		c.socketMode = mode
+		return nil
+	}
+}
+
+// WithListener makes the server accept connections on an existing listener,
+// instead of binding a new one. The configured port and address are ignored.
+func WithListener(listener net.Listener) Option {
+	return func(c *serverConfig) error {
+		if listener == nil {
+			return errors.New("listener must not be nil")
+		}
+		c.listener = listener
+		return nil
+	}
+}
+
+// WithServerOptions adds options to the underlying gRPC server.
+//
+// Options are applied after the defaults of this package,
+// so they can be used to override them.
+func WithServerOptions(opts ...grpc.ServerOption) Option {
+	return func(c *serverConfig) error {
+		c.serverOptions = append(c.serverOptions, opts...)
+		return nil
+	}
+}
+
+// WithUnaryInterceptors adds unary interceptors to the server.
+// Interceptors are registered in the order they are passed.
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(c *serverConfig) error {
+		c.unaryInterceptors = append(c.unaryInterceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithStreamInterceptors adds stream interceptors to the server.
+// Interceptors are registered in the order they are passed.
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(c *serverConfig) error {
+		c.streamInterceptors = append(c.streamInterceptors, interceptors...)
+		return nil
+	}
+}
+
+// WithHealth enables or disables the standard health service.
+// The health service is enabled by default.
+func WithHealth(enabled bool) Option {
+	return func(c *serverConfig) error {
+		c.health = enabled
+		return nil
+	}
+}
+
+// WithPreStopDelay sets how long Stop waits after setting the health status
+// to NOT_SERVING, before it stops accepting requests.
+// This gives load balancers time to notice the server is shutting down.
+func WithPreStopDelay(delay time.Duration) Option {
+	return func(c *serverConfig) error {
+		if delay < 0 {
+			return fmt.Errorf("invalid pre-stop delay %s", delay)
+		}
+		c.preStopDelay = delay
+		return nil
+	}
+}
+
+// WithDrainTimeout sets how long Stop waits for running requests to complete,
+// before closing all connections. The default is 30 seconds.
+// A timeout of zero waits for requests indefinitely.
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(c *serverConfig) error {
+		if timeout < 0 {
+			return fmt.Errorf("invalid drain timeout %s", timeout)
+		}
+		c.drainTimeout = timeout
+		return nil
+	}
+}
+
+// WithMetrics makes the server collect metrics on requests in the given metrics,
+// which are returned by GetMetrics.
+//
+// The metrics interceptors are registered before the other interceptors,
+// after the tracing interceptors set with WithTracing and the concurrency limit.
+// Use Metrics.ErrorInterceptor to count application errors in the same metrics.
+func WithMetrics(metrics *Metrics) Option {
+	return func(c *serverConfig) error {
+		if metrics == nil {
+			return errors.New("metrics must not be nil")
+		}
+		c.metrics = metrics
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the server.
+// The default writes to the standard logger of logrus.
+//
+// The logger is used by the server, and stored in the context of each request:
+// the interceptors of this package and the handlers retrieve it with LoggerFromContext.
+func WithLogger(logger Logger) Option {
+	return func(c *serverConfig) error {
+		if logger == nil {
+			return errors.New("logger must not be nil")
+		}
+		c.logger = logger
+		return nil
+	}
+}
@@ -0,0 +1,233 @@
+package grpc_server
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+)
+
+// prometheusRecorder records metrics with prometheus.
+type prometheusRecorder struct {
+	standard bool
+	exemplar ExemplarFunc
+
+	requestTime             *histogramSet
+	requestCounter          *prometheus.CounterVec
+	applicationErrorCounter *prometheus.CounterVec
+	concurrencyMetrics
+	messageMetrics
+
+	// only used with the default metric names
+	errorCounter         *prometheus.CounterVec
+	streamMessageCounter *prometheus.CounterVec
+
+	// only used with the standard metric names
+	startedCounter         *prometheus.CounterVec
+	messageReceivedCounter *prometheus.CounterVec
+	messageSentCounter     *prometheus.CounterVec
+}
+
+func newPrometheusRecorder(config *metricsConfig) *prometheusRecorder {
+	if config.standard {
+		return newStandardPrometheusRecorder(config)
+	}
+
+	return &prometheusRecorder{
+		exemplar:           config.exemplar,
+		concurrencyMetrics: newConcurrencyMetrics(config, config.subsystem, "request_", []string{"service", "method"}),
+		messageMetrics:     newMessageMetrics(config, config.subsystem, "request_", []string{"service", "method"}),
+		requestTime: newHistogramSet(prometheus.HistogramOpts{
+			Namespace:   config.namespace,
+			Subsystem:   config.subsystem,
+			Name:        "request_duration_seconds",
+			Help:        "Time to serve gRPC requests in seconds",
+			Buckets:     defaultLatencyBuckets,
+			ConstLabels: config.constLabels,
+		}, []string{"service", "method"}, config),
+		requestCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   config.subsystem,
+			Name:        "request_count_total",
+			Help:        "Counter for served gRPC requests, by status code",
+			ConstLabels: config.constLabels,
+		}, []string{"service", "method", "code"}),
+		errorCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   config.subsystem,
+			Name:        "request_error_count_total",
+			Help:        "Counter for failed gRPC requests, by status code",
+			ConstLabels: config.constLabels,
+		}, []string{"service", "method", "code"}),
+		applicationErrorCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   config.subsystem,
+			Name:        "request_application_error_count_total",
+			Help:        "Counter for failed gRPC requests with application errors",
+			ConstLabels: config.constLabels,
+		}, []string{"service", "method", "code"}),
+		streamMessageCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   config.subsystem,
+			Name:        "stream_message_count_total",
+			Help:        "Counter for messages sent and received on gRPC streams",
+			ConstLabels: config.constLabels,
+		}, []string{"service", "method", "direction"}),
+	}
+}
+
+func newStandardPrometheusRecorder(config *metricsConfig) *prometheusRecorder {
+	subsystem := "server"
+	if config.subsystem != "" {
+		subsystem = config.subsystem + "_server"
+	}
+
+	labels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	codeLabels := []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"}
+
+	return &prometheusRecorder{
+		exemplar:           config.exemplar,
+		standard:           true,
+		concurrencyMetrics: newConcurrencyMetrics(config, subsystem, "", labels),
+		messageMetrics:     newMessageMetrics(config, subsystem, "", labels),
+		startedCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   subsystem,
+			Name:        "started_total",
+			Help:        "Total number of RPCs started on the server.",
+			ConstLabels: config.constLabels,
+		}, labels),
+		requestCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   subsystem,
+			Name:        "handled_total",
+			Help:        "Total number of RPCs completed on the server, regardless of success or failure.",
+			ConstLabels: config.constLabels,
+		}, codeLabels),
+		requestTime: newHistogramSet(prometheus.HistogramOpts{
+			Namespace:   config.namespace,
+			Subsystem:   subsystem,
+			Name:        "handling_seconds",
+			Help:        "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
+			Buckets:     prometheus.DefBuckets,
+			ConstLabels: config.constLabels,
+		}, labels, config),
+		messageReceivedCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   subsystem,
+			Name:        "msg_received_total",
+			Help:        "Total number of RPC stream messages received on the server.",
+			ConstLabels: config.constLabels,
+		}, labels),
+		messageSentCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   subsystem,
+			Name:        "msg_sent_total",
+			Help:        "Total number of gRPC stream messages sent by the server.",
+			ConstLabels: config.constLabels,
+		}, labels),
+		applicationErrorCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   config.namespace,
+			Subsystem:   subsystem,
+			Name:        "application_errors_total",
+			Help:        "Total number of RPCs that failed with application errors.",
+			ConstLabels: config.constLabels,
+		}, codeLabels),
+	}
+}
+
+// Collectors returns the prometheus collectors of the recorder.
+func (m *prometheusRecorder) Collectors() []prometheus.Collector {
+	if m.standard {
+		return append([]prometheus.Collector{
+			m.startedCounter,
+			m.requestCounter,
+			m.requestTime,
+			m.messageReceivedCounter,
+			m.messageSentCounter,
+			m.applicationErrorCounter,
+		}, append(m.concurrencyMetrics.collectors(), m.messageMetrics.collectors()...)...)
+	}
+
+	return append([]prometheus.Collector{
+		m.requestTime,
+		m.requestCounter,
+		m.errorCounter,
+		m.applicationErrorCounter,
+		m.streamMessageCounter,
+	}, append(m.concurrencyMetrics.collectors(), m.messageMetrics.collectors()...)...)
+}
+
+func (m *prometheusRecorder) labels(rpc RPCInfo) prometheus.Labels {
+	if m.standard {
+		return prometheus.Labels{"grpc_type": rpc.Type, "grpc_service": rpc.Service, "grpc_method": rpc.Method}
+	}
+	return prometheus.Labels{"service": rpc.Service, "method": rpc.Method}
+}
+
+func (m *prometheusRecorder) codeLabels(rpc RPCInfo, code codes.Code) prometheus.Labels {
+	labels := m.labels(rpc)
+	if m.standard {
+		labels["grpc_code"] = code.String()
+	} else {
+		labels["code"] = code.String()
+	}
+	return labels
+}
+
+func (m *prometheusRecorder) RPCStarted(ctx context.Context, rpc RPCInfo) {
+	if m.startedCounter != nil {
+		m.startedCounter.With(m.labels(rpc)).Inc()
+	}
+
+	m.inFlight.With(m.labels(rpc)).Inc()
+	m.inFlightPeak.inc()
+}
+
+func (m *prometheusRecorder) RPCHandled(ctx context.Context, rpc RPCInfo, code codes.Code, duration time.Duration) {
+	m.inFlight.With(m.labels(rpc)).Dec()
+	m.inFlightPeak.dec()
+
+	exemplar := m.exemplarLabels(ctx)
+
+	observe(m.requestTime.with(rpc.FullMethod, m.labels(rpc)), duration.Seconds(), exemplar)
+
+	inc(m.requestCounter.With(m.codeLabels(rpc, code)), exemplar)
+
+	if code != codes.OK && m.errorCounter != nil {
+		inc(m.errorCounter.With(m.codeLabels(rpc, code)), exemplar)
+	}
+}
+
+func (m *prometheusRecorder) ApplicationError(ctx context.Context, rpc RPCInfo, code codes.Code) {
+	inc(m.applicationErrorCounter.With(m.codeLabels(rpc, code)), m.exemplarLabels(ctx))
+}
+
+func (m *prometheusRecorder) MessageReceived(ctx context.Context, rpc RPCInfo, size int) {
+	m.observeMessageSize(rpc, "received", size)
+
+	if m.standard {
+		m.messageReceivedCounter.With(m.labels(rpc)).Inc()
+	} else if rpc.Type != unaryRPC {
+		labels := m.labels(rpc)
+		labels["direction"] = "received"
+		m.streamMessageCounter.With(labels).Inc()
+	}
+}
+
+func (m *prometheusRecorder) MessageSent(ctx context.Context, rpc RPCInfo, size int) {
+	m.observeMessageSize(rpc, "sent", size)
+
+	if m.standard {
+		m.messageSentCounter.With(m.labels(rpc)).Inc()
+	} else if rpc.Type != unaryRPC {
+		labels := m.labels(rpc)
+		labels["direction"] = "sent"
+		m.streamMessageCounter.With(labels).Inc()
+	}
+}
+
+func (m *prometheusRecorder) QueueWait(ctx context.Context, rpc RPCInfo, wait time.Duration) {
+	m.queueWait.With(m.labels(rpc)).Observe(wait.Seconds())
+}
@@ -0,0 +1,83 @@
+package grpc_server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// Recorder records the metrics collected by the interceptors of Metrics.
+//
+// NewMetrics records metrics with prometheus by default.
+// Use WithRecorder to record them with another implementation,
+// e.g. the one returned by NewOpenTelemetryRecorder.
+// The methods of a Recorder are called concurrently.
+type Recorder interface {
+	// RPCStarted is called when the server starts handling an RPC.
+	RPCStarted(ctx context.Context, rpc RPCInfo)
+	// RPCHandled is called when the server has handled an RPC,
+	// with the status code returned to the client.
+	RPCHandled(ctx context.Context, rpc RPCInfo, code codes.Code, duration time.Duration)
+	// MessageReceived is called for each message received,
+	// with its size in bytes, or -1 if the size is not known.
+	MessageReceived(ctx context.Context, rpc RPCInfo, size int)
+	// MessageSent is called for each message sent,
+	// with its size in bytes, or -1 if the size is not known.
+	MessageSent(ctx context.Context, rpc RPCInfo, size int)
+	// MessagesPerRPC is called when the server has handled an RPC,
+	// with the number of messages received and sent.
+	MessagesPerRPC(ctx context.Context, rpc RPCInfo, received, sent int)
+	// ApplicationError is called when an RPC fails with an application error,
+	// with the status code of the error.
+	ApplicationError(ctx context.Context, rpc RPCInfo, code codes.Code)
+	// QueueWait is called when an RPC starts after waiting for the concurrency limit.
+	QueueWait(ctx context.Context, rpc RPCInfo, wait time.Duration)
+}
+
+const (
+	unaryRPC        = "unary"
+	clientStreamRPC = "client_stream"
+	serverStreamRPC = "server_stream"
+	bidiStreamRPC   = "bidi_stream"
+)
+
+// RPCInfo identifies the RPC a metric is recorded for.
+type RPCInfo struct {
+	// FullMethod is the full name of the method, e.g. /package.Service/Method.
+	FullMethod string
+	// Type is unary, client_stream, server_stream or bidi_stream.
+	Type    string
+	Service string
+	Method  string
+}
+
+func newRPCInfo(fullMethod string, rpcType string) RPCInfo {
+	service, method := splitMethod(fullMethod)
+	return RPCInfo{FullMethod: fullMethod, Type: rpcType, Service: service, Method: method}
+}
+
+// splitMethod splits a full method name, e.g. /package.Service/Method,
+// into the service and method names.
+func splitMethod(fullMethod string) (service, method string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+func streamRPCType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return bidiStreamRPC
+	case info.IsClientStream:
+		return clientStreamRPC
+	case info.IsServerStream:
+		return serverStreamRPC
+	default:
+		return unaryRPC
+	}
+}
@@ -3,9 +3,9 @@ package grpc_server
 import (
 	"context"
 	"fmt"
+	"runtime"
 	"runtime/debug"
 
-	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 )
 
@@ -20,19 +20,74 @@ func RecoverInterceptor(
 			recoveredErr := recover()
 
 			if recoveredErr != nil {
-				log.
-					WithField("request", req).
-					WithField("stack_trace", string(debug.Stack())).
-					Errorf("recovered a panic on %s: %v", info.FullMethod, recoveredErr)
-
-				if actualError, recoveredAnError := recoveredErr.(error); recoveredAnError {
-					finalError = fmt.Errorf("%s panicked: %w", info.FullMethod, actualError)
-				} else {
-					finalError = fmt.Errorf("%s panicked: %v", info.FullMethod, recoveredErr)
-				}
+				LoggerFromContext(ctx).Log(ctx, LevelError, fmt.Sprintf("recovered a panic on %s: %v", info.FullMethod, recoveredErr), Fields{
+					"request":     redactorFromContext(ctx).Redact(req),
+					"stack_trace": string(debug.Stack()),
+				})
+
+				finalError = panicError(info.FullMethod, recoveredErr)
 			}
 		}()
 
 		return handler(ctx, req)
 	}()
 }
+
+func RecoverStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) (err error) {
+	defer func() {
+		recoveredErr := recover()
+
+		if recoveredErr != nil {
+			ctx := ss.Context()
+			LoggerFromContext(ctx).Log(ctx, LevelError, fmt.Sprintf("recovered a panic on %s: %v", info.FullMethod, recoveredErr), Fields{
+				"stack_trace": string(debug.Stack()),
+			})
+
+			err = panicError(info.FullMethod, recoveredErr)
+		}
+	}()
+
+	return handler(srv, ss)
+}
+
+// PanicError is the error returned by the recover interceptors when a handler panics.
+type PanicError struct {
+	// Method is the full name of the method that panicked.
+	Method string
+	// Value is the value passed to panic.
+	Value interface{}
+
+	stack []uintptr
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Method, e.Value)
+}
+
+// Unwrap returns the value passed to panic, if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// StackTrace returns the program counters of the stack of the handler that panicked,
+// as returned by runtime.Callers.
+// Error reporting tools, such as the Sentry interceptors, use it to report where the panic happened.
+func (e *PanicError) StackTrace() []uintptr {
+	return e.stack
+}
+
+// panicError must be called by the deferred function that recovered the panic,
+// so that the stack of the handler is still available.
+func panicError(method string, recoveredErr interface{}) error {
+	stack := make([]uintptr, 64)
+	// skip runtime.Callers, panicError and the deferred function
+	n := runtime.Callers(3, stack)
+
+	return &PanicError{Method: method, Value: recoveredErr, stack: stack[:n]}
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/moveaxlab/go-grpc-server/internal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
 )
 
 func TestRecover(t *testing.T) {
@@ -25,4 +26,62 @@ func TestRecover(t *testing.T) {
 
 		assert.NotNil(t, err)
 	})
+
+	t.Run("stream server crashes without recover interceptor", func(t *testing.T) {
+		client, mockServer, cleanup := setupTestStreamServer(t, RecoverStreamInterceptor)
+		defer cleanup()
+
+		ctx := context.Background()
+
+		mockServer.On("Stream", mock.Anything).Run(func(_ mock.Arguments) {
+			panic(fmt.Errorf("panic"))
+		})
+
+		stream, err := client.Stream(ctx)
+		assert.Nil(t, err)
+
+		_, err = stream.Recv()
+
+		assert.NotNil(t, err)
+	})
+}
+
+func TestPanicError(t *testing.T) {
+	t.Run("keeps the panic value and stack", func(t *testing.T) {
+		panicValue := fmt.Errorf("panic")
+
+		_, err := RecoverInterceptor(
+			context.Background(),
+			nil,
+			&grpc.UnaryServerInfo{FullMethod: "/internal.TestService/Endpoint"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				panic(panicValue)
+			},
+		)
+
+		var panicErr *PanicError
+		if assert.ErrorAs(t, err, &panicErr) {
+			assert.Equal(t, "/internal.TestService/Endpoint", panicErr.Method)
+			assert.Equal(t, "/internal.TestService/Endpoint panicked: panic", panicErr.Error())
+			assert.NotEmpty(t, panicErr.StackTrace())
+		}
+		assert.ErrorIs(t, err, panicValue)
+	})
+
+	t.Run("wraps only errors", func(t *testing.T) {
+		err := RecoverStreamInterceptor(
+			nil,
+			&contextServerStream{ctx: context.Background()},
+			&grpc.StreamServerInfo{FullMethod: "/internal.TestService/Stream"},
+			func(srv interface{}, stream grpc.ServerStream) error {
+				panic("panic")
+			},
+		)
+
+		var panicErr *PanicError
+		if assert.ErrorAs(t, err, &panicErr) {
+			assert.Equal(t, "panic", panicErr.Value)
+			assert.Nil(t, panicErr.Unwrap())
+		}
+	})
 }
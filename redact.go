@@ -0,0 +1,243 @@
+package grpc_server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// redacted replaces the values of sensitive fields and metadata.
+const redacted = "[REDACTED]"
+
+// defaultMaxFieldSize is the size above which strings and bytes are truncated by default.
+const defaultMaxFieldSize = 1024
+
+// sensitiveMetadata lists the metadata keys whose values are never reported.
+var sensitiveMetadata = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+}
+
+// redactMetadata returns the values of the metadata joined by key,
+// replacing the values of sensitive keys.
+func redactMetadata(md metadata.MD) map[string]string {
+	res := make(map[string]string, len(md))
+	for key, values := range md {
+		if sensitiveMetadata[key] {
+			res[key] = redacted
+		} else {
+			res[key] = strings.Join(values, ", ")
+		}
+	}
+	return res
+}
+
+// Redactor masks the sensitive fields of the requests that are logged or reported to Sentry.
+//
+// Fields marked with the debug_redact option are always masked.
+// Create it with NewRedactor and pass it to the server with WithRedactor.
+type Redactor struct {
+	patterns     []string
+	maxFieldSize int
+}
+
+// RedactorOption configures the redactor created by NewRedactor.
+type RedactorOption func(*redactorConfig) error
+
+type redactorConfig struct {
+	patterns     []string
+	maxFieldSize int
+}
+
+func defaultRedactorConfig() *redactorConfig {
+	return &redactorConfig{
+		maxFieldSize: defaultMaxFieldSize,
+	}
+}
+
+// WithRedactedFields masks the fields whose name matches one of the given patterns,
+// e.g. "password", "*token*" or "mypackage.User.email".
+// Patterns use the syntax of path.Match, and are matched case-insensitively
+// against the name and the full name of each field.
+func WithRedactedFields(patterns ...string) RedactorOption {
+	return func(c *redactorConfig) error {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid redacted field pattern %q: %w", pattern, err)
+			}
+			c.patterns = append(c.patterns, strings.ToLower(pattern))
+		}
+		return nil
+	}
+}
+
+// WithMaxFieldSize sets the size in bytes above which strings and bytes are truncated.
+// The default is 1024 bytes, and a size of zero disables truncation.
+func WithMaxFieldSize(size int) RedactorOption {
+	return func(c *redactorConfig) error {
+		if size < 0 {
+			return fmt.Errorf("invalid max field size %d", size)
+		}
+		c.maxFieldSize = size
+		return nil
+	}
+}
+
+// NewRedactor creates a redactor.
+// It returns an error if an option is invalid.
+func NewRedactor(opts ...RedactorOption) (*Redactor, error) {
+	config := defaultRedactorConfig()
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Redactor{
+		patterns:     config.patterns,
+		maxFieldSize: config.maxFieldSize,
+	}, nil
+}
+
+// WithRedactor sets the redactor of the requests logged by the interceptors of this package,
+// and reported to Sentry.
+// By default, only the fields marked with the debug_redact option are masked,
+// and strings and bytes longer than 1024 bytes are truncated.
+func WithRedactor(redactor *Redactor) Option {
+	return func(c *serverConfig) error {
+		if redactor == nil {
+			return errors.New("redactor must not be nil")
+		}
+		c.redactor = redactor
+		return nil
+	}
+}
+
+var defaultRedactor = &Redactor{maxFieldSize: defaultMaxFieldSize}
+
+type redactorKey struct{}
+
+// redactorFromContext returns the redactor of the server that handles a request.
+func redactorFromContext(ctx context.Context) *Redactor {
+	if redactor, ok := ctx.Value(redactorKey{}).(*Redactor); ok {
+		return redactor
+	}
+	return defaultRedactor
+}
+
+// Redact returns a copy of a protobuf message, replacing the values of sensitive fields
+// and truncating large strings and bytes.
+// Singular string fields are replaced with "[REDACTED]", the other sensitive fields are cleared.
+// Values that are not protobuf messages are returned as they are.
+func (r *Redactor) Redact(req interface{}) interface{} {
+	message, ok := req.(proto.Message)
+	if !ok {
+		return req
+	}
+
+	clone := proto.Clone(message)
+	r.redactMessage(clone.ProtoReflect())
+	return clone
+}
+
+func (r *Redactor) redactMessage(m protoreflect.Message) {
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		if r.isRedacted(fd) {
+			if fd.Kind() == protoreflect.StringKind && fd.Cardinality() != protoreflect.Repeated {
+				m.Set(fd, protoreflect.ValueOfString(redacted))
+			} else {
+				m.Clear(fd)
+			}
+			return true
+		}
+
+		switch {
+		case fd.IsMap():
+			values := v.Map()
+			values.Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+				if fd.MapValue().Message() != nil {
+					r.redactMessage(value.Message())
+				} else if truncated, ok := r.truncate(fd.MapValue().Kind(), value); ok {
+					values.Set(key, truncated)
+				}
+				return true
+			})
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				if fd.Message() != nil {
+					r.redactMessage(list.Get(i).Message())
+				} else if truncated, ok := r.truncate(fd.Kind(), list.Get(i)); ok {
+					list.Set(i, truncated)
+				}
+			}
+		case fd.Message() != nil:
+			r.redactMessage(v.Message())
+		default:
+			if truncated, ok := r.truncate(fd.Kind(), v); ok {
+				m.Set(fd, truncated)
+			}
+		}
+
+		return true
+	})
+}
+
+func (r *Redactor) isRedacted(fd protoreflect.FieldDescriptor) bool {
+	if options, ok := fd.Options().(*descriptorpb.FieldOptions); ok && options.GetDebugRedact() {
+		return true
+	}
+
+	name := strings.ToLower(string(fd.Name()))
+	fullName := strings.ToLower(string(fd.FullName()))
+	for _, pattern := range r.patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, fullName); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// truncate returns the value of a string or bytes field cut to the max field size,
+// and whether it was cut. Truncated strings end with "...".
+func (r *Redactor) truncate(kind protoreflect.Kind, v protoreflect.Value) (protoreflect.Value, bool) {
+	if r.maxFieldSize == 0 {
+		return v, false
+	}
+
+	switch kind {
+	case protoreflect.StringKind:
+		s := v.String()
+		if len(s) <= r.maxFieldSize {
+			return v, false
+		}
+		end := r.maxFieldSize
+		for end > 0 && !utf8.RuneStart(s[end]) {
+			end--
+		}
+		return protoreflect.ValueOfString(s[:end] + "..."), true
+	case protoreflect.BytesKind:
+		b := v.Bytes()
+		if len(b) <= r.maxFieldSize {
+			return v, false
+		}
+		return protoreflect.ValueOfBytes(b[:r.maxFieldSize]), true
+	default:
+		return v, false
+	}
+}
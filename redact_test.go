@@ -0,0 +1,122 @@
+package grpc_server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRedactor(t *testing.T) {
+	t.Run("masks sensitive fields", func(t *testing.T) {
+		req := &internal.Input{Value: "Hello", Secret: "password"}
+
+		redactedReq := defaultRedactor.Redact(req).(*internal.Input)
+
+		assert.Equal(t, "Hello", redactedReq.Value)
+		assert.Equal(t, "[REDACTED]", redactedReq.Secret)
+		// the request is not modified
+		assert.Equal(t, "password", req.Secret)
+	})
+
+	t.Run("masks fields matching a pattern", func(t *testing.T) {
+		for _, pattern := range []string{"VALUE", "val*", "internal.Input.value"} {
+			redactor, err := NewRedactor(WithRedactedFields(pattern))
+			assert.Nil(t, err)
+
+			redactedReq := redactor.Redact(&internal.Input{Value: "Hello", Payload: []byte("data")}).(*internal.Input)
+			assert.Equal(t, "[REDACTED]", redactedReq.Value, pattern)
+			assert.Equal(t, []byte("data"), redactedReq.Payload, pattern)
+		}
+
+		redactor, err := NewRedactor(WithRedactedFields("payload"))
+		assert.Nil(t, err)
+
+		redactedReq := redactor.Redact(&internal.Input{Value: "Hello", Payload: []byte("data")}).(*internal.Input)
+		assert.Nil(t, redactedReq.Payload)
+	})
+
+	t.Run("truncates large strings and bytes", func(t *testing.T) {
+		redactor, err := NewRedactor(WithMaxFieldSize(4))
+		assert.Nil(t, err)
+
+		redactedReq := redactor.Redact(&internal.Input{Value: "Hellò world", Payload: []byte("payload")}).(*internal.Input)
+		assert.Equal(t, "Hell...", redactedReq.Value)
+		assert.Equal(t, []byte("payl"), redactedReq.Payload)
+
+		// strings are not cut in the middle of a character
+		redactedReq = redactor.Redact(&internal.Input{Value: "Helò"}).(*internal.Input)
+		assert.Equal(t, "Hel...", redactedReq.Value)
+
+		redactedReq = defaultRedactor.Redact(&internal.Input{Value: strings.Repeat("a", 2000)}).(*internal.Input)
+		assert.Len(t, redactedReq.Value, defaultMaxFieldSize+len("..."))
+
+		redactor, err = NewRedactor(WithMaxFieldSize(0))
+		assert.Nil(t, err)
+
+		req := &internal.Input{Value: strings.Repeat("a", 2000)}
+		assert.True(t, proto.Equal(req, redactor.Redact(req).(*internal.Input)))
+	})
+
+	t.Run("returns values that are not messages as they are", func(t *testing.T) {
+		assert.Equal(t, "request", defaultRedactor.Redact("request"))
+	})
+
+	t.Run("redacts the requests logged by the interceptors", func(t *testing.T) {
+		logger, hook := test.NewNullLogger()
+		redactor, err := NewRedactor(WithRedactedFields("value"))
+		assert.Nil(t, err)
+
+		mockServer, cc, cleanup := startTestServer(t,
+			WithLogger(NewLogrusLogger(logger)),
+			WithRedactor(redactor),
+			WithUnaryInterceptors(ValidationInterceptor, RecoverInterceptor),
+		)
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+			panic("something went wrong")
+		})
+
+		client := internal.NewTestServiceClient(cc)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello", Secret: "password"})
+		assert.NotNil(t, err)
+
+		entry := hook.LastEntry()
+		if assert.NotNil(t, entry) {
+			request := entry.Data["request"].(*internal.Input)
+			assert.Equal(t, "[REDACTED]", request.Value)
+			assert.Equal(t, "[REDACTED]", request.Secret)
+		}
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hi", Secret: "password"})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+		entry = hook.LastEntry()
+		if assert.NotNil(t, entry) {
+			assert.Equal(t, "validation failed on /internal.TestService/Endpoint: value is too short", entry.Message)
+			request := entry.Data["request"].(*internal.Input)
+			assert.Equal(t, "[REDACTED]", request.Value)
+			assert.Equal(t, "[REDACTED]", request.Secret)
+		}
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := NewRedactor(WithRedactedFields("[a-"))
+		assert.NotNil(t, err)
+
+		_, err = NewRedactor(WithMaxFieldSize(-1))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithRedactor(nil))
+		assert.NotNil(t, err)
+	})
+}
@@ -0,0 +1,64 @@
+package grpc_server
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// SignalContext returns a copy of the parent context that is cancelled
+// when the process receives SIGINT or SIGTERM, or when the returned stop
+// function is called.
+func SignalContext(parent context.Context) (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(parent, syscall.SIGINT, syscall.SIGTERM)
+}
+
+func (l *listener) Run(ctx context.Context) error {
+	// a nil channel never receives, disabling upgrades
+	var upgrade chan os.Signal
+	if len(l.upgradeSignals) > 0 {
+		upgrade = make(chan os.Signal, 1)
+		signal.Notify(upgrade, l.upgradeSignals...)
+		defer signal.Stop(upgrade)
+	}
+
+	err := l.Listen()
+	if err != nil {
+		return err
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- l.Wait()
+	}()
+
+	for {
+		select {
+		case err := <-serveErr:
+			// the server failed, or was stopped by a call to Stop or Upgrade:
+			// in the latter case, this waits for that stop and returns its error
+			stopErr := l.shutdown(false)
+			if err != nil {
+				return err
+			}
+			return stopErr
+		case <-upgrade:
+			if err := l.handoff(); err != nil {
+				l.logf(LevelError, "failed to upgrade gRPC server: %v", err)
+				continue
+			}
+			stopErr := l.shutdown(false)
+			if err := <-serveErr; err != nil {
+				return err
+			}
+			return stopErr
+		case <-ctx.Done():
+			stopErr := l.Stop()
+			if err := <-serveErr; err != nil {
+				return err
+			}
+			return stopErr
+		}
+	}
+}
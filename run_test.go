@@ -0,0 +1,173 @@
+package grpc_server
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("serves until the context is cancelled", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener))
+		assert.Nil(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- server.Run(ctx)
+		}()
+
+		cc, err := grpc.Dial(tcpListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		res, err := healthgrpc.NewHealthClient(cc).Check(context.Background(), &healthgrpc.HealthCheckRequest{}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+		assert.Equal(t, healthgrpc.HealthCheckResponse_SERVING, res.Status)
+
+		cancel()
+
+		assert.Nil(t, <-runErr)
+	})
+
+	t.Run("returns the bind error", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+		defer tcpListener.Close()
+
+		server, err := NewServer(WithPort(tcpListener.Addr().(*net.TCPAddr).Port))
+		assert.Nil(t, err)
+
+		err = server.Run(context.Background())
+		assert.NotNil(t, err)
+	})
+
+	t.Run("returns serve failures", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener))
+		assert.Nil(t, err)
+
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- server.Run(context.Background())
+		}()
+
+		cc, err := grpc.Dial(tcpListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		_, err = healthgrpc.NewHealthClient(cc).Check(context.Background(), &healthgrpc.HealthCheckRequest{}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+
+		err = tcpListener.Close()
+		assert.Nil(t, err)
+
+		assert.NotNil(t, <-runErr)
+	})
+
+	t.Run("skips the pre-stop delay when serving fails", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener), WithPreStopDelay(time.Minute))
+		assert.Nil(t, err)
+
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- server.Run(context.Background())
+		}()
+
+		cc, err := grpc.Dial(tcpListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		_, err = healthgrpc.NewHealthClient(cc).Check(context.Background(), &healthgrpc.HealthCheckRequest{}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+
+		err = tcpListener.Close()
+		assert.Nil(t, err)
+
+		select {
+		case err := <-runErr:
+			assert.NotNil(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Run waited for the pre-stop delay")
+		}
+	})
+
+	t.Run("returns the error of a stop called outside Run", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener), WithDrainTimeout(100*time.Millisecond))
+		assert.Nil(t, err)
+
+		mockServer := &internal.MockTestServiceServer{}
+		internal.RegisterTestServiceServer(server.GetServer(), mockServer)
+
+		received := make(chan struct{})
+		release := make(chan struct{})
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(_ mock.Arguments) {
+			close(received)
+			<-release
+		}).Return(&internal.Output{Value: "World"}, nil)
+
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- server.Run(context.Background())
+		}()
+
+		cc, err := grpc.Dial(tcpListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		go func() {
+			_, _ = internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		}()
+
+		<-received
+
+		stopErr := server.Stop()
+
+		var drainTimeoutError *DrainTimeoutError
+		assert.ErrorAs(t, stopErr, &drainTimeoutError)
+
+		// the server stops serving once the interrupted handlers return
+		close(release)
+
+		assert.Equal(t, stopErr, <-runErr)
+	})
+}
+
+func TestSignalContext(t *testing.T) {
+	ctx, stop := SignalContext(context.Background())
+	defer stop()
+
+	process, err := os.FindProcess(os.Getpid())
+	assert.Nil(t, err)
+
+	err = process.Signal(syscall.SIGTERM)
+	assert.Nil(t, err)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context was not cancelled by SIGTERM")
+	}
+}
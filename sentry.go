@@ -0,0 +1,330 @@
+package grpc_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/getsentry/sentry-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Sentry reports the errors of a gRPC server to Sentry.
+//
+// Create it with NewSentry, and register its interceptors after NewErrorInterceptor
+// and before RecoverInterceptor, so that they see application errors and recovered panics.
+type Sentry struct {
+	hub          *sentry.Hub
+	user         func(ctx context.Context) (sentry.User, bool)
+	transactions bool
+	sampleRates  map[string]float64
+}
+
+// SentryOption configures the Sentry interceptors created by NewSentry.
+type SentryOption func(*sentryConfig) error
+
+type sentryConfig struct {
+	hub          *sentry.Hub
+	user         func(ctx context.Context) (sentry.User, bool)
+	transactions bool
+	sampleRates  map[string]float64
+}
+
+func defaultSentryConfig() *sentryConfig {
+	return &sentryConfig{
+		user:        peerIdentityUser,
+		sampleRates: make(map[string]float64),
+	}
+}
+
+// WithSentryHub sets the hub the events are sent to.
+// The default is the hub of the sentry package, as configured by sentry.Init.
+func WithSentryHub(hub *sentry.Hub) SentryOption {
+	return func(c *sentryConfig) error {
+		if hub == nil {
+			return errors.New("sentry hub must not be nil")
+		}
+		c.hub = hub
+		return nil
+	}
+}
+
+// WithSentryUser sets the function that extracts the user that made a request from its context.
+// By default, the user is the client identity extracted by the identity interceptors, if any.
+func WithSentryUser(user func(ctx context.Context) (sentry.User, bool)) SentryOption {
+	return func(c *sentryConfig) error {
+		if user == nil {
+			return errors.New("sentry user function must not be nil")
+		}
+		c.user = user
+		return nil
+	}
+}
+
+// WithSentryTransactions enables or disables Sentry performance monitoring.
+// When enabled, each request starts a transaction named after its full method,
+// continuing the trace of the sentry-trace and baggage metadata sent by the client.
+// Transactions are disabled by default.
+//
+// Transactions are only sent if tracing is enabled in the options of the Sentry client,
+// and are sampled with its TracesSampleRate or TracesSampler,
+// unless a sample rate is set for the method with WithSentrySampleRate.
+func WithSentryTransactions(enabled bool) SentryOption {
+	return func(c *sentryConfig) error {
+		c.transactions = enabled
+		return nil
+	}
+}
+
+// WithSentrySampleRate sets the rate at which the transactions of the given methods are sampled,
+// between 0 and 1, e.g. 0 to never send the transactions of the health check.
+// The sampling decision of the client, sent in the sentry-trace metadata, takes precedence.
+func WithSentrySampleRate(rate float64, methods ...string) SentryOption {
+	return func(c *sentryConfig) error {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("invalid sentry sample rate %v", rate)
+		}
+		if len(methods) == 0 {
+			return errors.New("sentry sample rate requires at least one method")
+		}
+		for _, method := range methods {
+			c.sampleRates[method] = rate
+		}
+		return nil
+	}
+}
+
+// NewSentry creates the Sentry interceptors of a gRPC server.
+// It returns an error if an option is invalid.
+func NewSentry(opts ...SentryOption) (*Sentry, error) {
+	config := defaultSentryConfig()
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	hub := config.hub
+	if hub == nil {
+		hub = sentry.CurrentHub()
+	}
+
+	return &Sentry{
+		hub:          hub,
+		user:         config.user,
+		transactions: config.transactions,
+		sampleRates:  config.sampleRates,
+	}, nil
+}
+
+// UnaryInterceptor returns an interceptor that reports errors to Sentry,
+// except application errors.
+//
+// Each request gets its own hub, stored in the request context:
+// use sentry.GetHubFromContext to add breadcrumbs and tags to the reported events.
+// Events include the method, the status code, the request and the metadata,
+// redacting fields marked with the debug_redact option and sensitive metadata
+// like the authorization header, and are grouped by method and status code.
+// Panics recovered by RecoverInterceptor are reported with the stack of the handler.
+//
+// If transactions are enabled with WithSentryTransactions, the transaction of the request
+// is stored in the request context, and its status is set from the returned status code:
+// use sentry.StartSpan with the request context to add spans to it.
+func (s *Sentry) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		hub := s.hub.Clone()
+		ctx = sentry.SetHubOnContext(ctx, hub)
+
+		ctx, transaction := s.startTransaction(ctx, info.FullMethod)
+
+		resp, err = handler(ctx, req)
+
+		if err != nil && !IsApplicationError(err) {
+			s.report(ctx, hub, info.FullMethod, req, err)
+		}
+		finishTransaction(transaction, err)
+
+		return resp, err
+	}
+}
+
+// StreamInterceptor returns the stream counterpart of UnaryInterceptor.
+// Stream events do not include the messages.
+func (s *Sentry) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		hub := s.hub.Clone()
+		ctx := sentry.SetHubOnContext(ss.Context(), hub)
+
+		ctx, transaction := s.startTransaction(ctx, info.FullMethod)
+
+		err := handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+
+		if err != nil && !IsApplicationError(err) {
+			s.report(ctx, hub, info.FullMethod, nil, err)
+		}
+		finishTransaction(transaction, err)
+
+		return err
+	}
+}
+
+func (s *Sentry) report(ctx context.Context, hub *sentry.Hub, fullMethod string, req interface{}, err error) {
+	client := hub.Client()
+	if client == nil {
+		return
+	}
+
+	code := status.Code(err)
+
+	hub.WithScope(func(scope *sentry.Scope) {
+		if user, ok := s.user(ctx); ok {
+			scope.SetUser(user)
+		}
+
+		grpcContext := sentry.Context{
+			"method": fullMethod,
+			"code":   code.String(),
+		}
+		if req != nil {
+			grpcContext["request"] = sentryRequest(redactorFromContext(ctx), req)
+		}
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			grpcContext["metadata"] = redactMetadata(md)
+		}
+		scope.SetContext("grpc", grpcContext)
+
+		scope.SetTag("grpc.method", fullMethod)
+		scope.SetTag("grpc.code", code.String())
+		scope.SetFingerprint([]string{fullMethod, code.String()})
+
+		level := sentry.LevelError
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			level = sentry.LevelFatal
+		}
+
+		event := client.EventFromException(err, level)
+		if level == sentry.LevelFatal && len(event.Exception) > 0 {
+			handled := false
+			event.Exception[len(event.Exception)-1].Mechanism = &sentry.Mechanism{
+				Type:    "grpc.panic",
+				Handled: &handled,
+			}
+		}
+
+		hub.CaptureEvent(event)
+	})
+}
+
+// startTransaction starts the transaction of a request, if transactions are enabled,
+// and returns the context that contains it.
+func (s *Sentry) startTransaction(ctx context.Context, fullMethod string) (context.Context, *sentry.Span) {
+	if !s.transactions {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	carrier := metadataCarrier(md)
+
+	transaction := sentry.StartTransaction(
+		ctx,
+		fullMethod,
+		sentry.WithOpName("grpc.server"),
+		sentry.WithTransactionSource(sentry.SourceRoute),
+		sentry.ContinueFromHeaders(carrier.Get(sentry.SentryTraceHeader), carrier.Get(sentry.SentryBaggageHeader)),
+		s.sampleMethod(fullMethod),
+	)
+	transaction.SetData("rpc.system", "grpc")
+	transaction.SetData("rpc.method", fullMethod)
+
+	return transaction.Context(), transaction
+}
+
+// sampleMethod makes the sampling decision for the transactions of methods with a sample rate,
+// unless the decision was already made by the client.
+func (s *Sentry) sampleMethod(fullMethod string) sentry.SpanOption {
+	return func(span *sentry.Span) {
+		rate, ok := s.sampleRates[fullMethod]
+		if !ok || span.Sampled != sentry.SampledUndefined {
+			return
+		}
+		if rate > 0 && rand.Float64() < rate {
+			span.Sampled = sentry.SampledTrue
+		} else {
+			span.Sampled = sentry.SampledFalse
+		}
+	}
+}
+
+// finishTransaction sets the status of a transaction from the returned error, and sends it.
+func finishTransaction(transaction *sentry.Span, err error) {
+	if transaction == nil {
+		return
+	}
+
+	code := status.Code(err)
+	transaction.Status = sentrySpanStatuses[code]
+	transaction.SetTag("grpc.code", code.String())
+	transaction.Finish()
+}
+
+var sentrySpanStatuses = map[codes.Code]sentry.SpanStatus{
+	codes.OK:                 sentry.SpanStatusOK,
+	codes.Canceled:           sentry.SpanStatusCanceled,
+	codes.Unknown:            sentry.SpanStatusUnknown,
+	codes.InvalidArgument:    sentry.SpanStatusInvalidArgument,
+	codes.DeadlineExceeded:   sentry.SpanStatusDeadlineExceeded,
+	codes.NotFound:           sentry.SpanStatusNotFound,
+	codes.AlreadyExists:      sentry.SpanStatusAlreadyExists,
+	codes.PermissionDenied:   sentry.SpanStatusPermissionDenied,
+	codes.ResourceExhausted:  sentry.SpanStatusResourceExhausted,
+	codes.FailedPrecondition: sentry.SpanStatusFailedPrecondition,
+	codes.Aborted:            sentry.SpanStatusAborted,
+	codes.OutOfRange:         sentry.SpanStatusOutOfRange,
+	codes.Unimplemented:      sentry.SpanStatusUnimplemented,
+	codes.Internal:           sentry.SpanStatusInternalError,
+	codes.Unavailable:        sentry.SpanStatusUnavailable,
+	codes.DataLoss:           sentry.SpanStatusDataLoss,
+	codes.Unauthenticated:    sentry.SpanStatusUnauthenticated,
+}
+
+// sentryRequest renders a request for a Sentry event, redacting sensitive fields.
+func sentryRequest(redactor *Redactor, req interface{}) interface{} {
+	message, ok := redactor.Redact(req).(proto.Message)
+	if !ok {
+		return req
+	}
+
+	data, err := protojson.Marshal(message)
+	if err != nil {
+		return redacted
+	}
+	return json.RawMessage(data)
+}
+
+// peerIdentityUser returns the identity of the client as a Sentry user.
+func peerIdentityUser(ctx context.Context) (sentry.User, bool) {
+	id, ok := peerIdentityID(ctx)
+	if !ok {
+		return sentry.User{}, false
+	}
+
+	return sentry.User{ID: id}, true
+}
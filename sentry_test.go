@@ -0,0 +1,366 @@
+package grpc_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSentryTransport collects the events sent to Sentry.
+type fakeSentryTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *fakeSentryTransport) Configure(sentry.ClientOptions) {}
+
+func (t *fakeSentryTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *fakeSentryTransport) Flush(time.Duration) bool {
+	return true
+}
+
+func (t *fakeSentryTransport) Events() []*sentry.Event {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*sentry.Event(nil), t.events...)
+}
+
+func newTestSentry(t *testing.T, opts ...SentryOption) (*Sentry, *fakeSentryTransport) {
+	return newTestSentryWithClientOptions(t, sentry.ClientOptions{}, opts...)
+}
+
+// newTestSentryTracing creates Sentry interceptors with transactions enabled,
+// sending all transactions.
+func newTestSentryTracing(t *testing.T, opts ...SentryOption) (*Sentry, *fakeSentryTransport) {
+	return newTestSentryWithClientOptions(t, sentry.ClientOptions{
+		EnableTracing:    true,
+		TracesSampleRate: 1,
+	}, append([]SentryOption{WithSentryTransactions(true)}, opts...)...)
+}
+
+func newTestSentryWithClientOptions(t *testing.T, options sentry.ClientOptions, opts ...SentryOption) (*Sentry, *fakeSentryTransport) {
+	transport := &fakeSentryTransport{}
+	options.Dsn = "https://public@sentry.example.com/1"
+	options.Transport = transport
+	client, err := sentry.NewClient(options)
+	assert.Nil(t, err)
+
+	s, err := NewSentry(append([]SentryOption{WithSentryHub(sentry.NewHub(client, sentry.NewScope()))}, opts...)...)
+	assert.Nil(t, err)
+
+	return s, transport
+}
+
+func TestSentry(t *testing.T) {
+	t.Run("reports errors with the request and metadata", func(t *testing.T) {
+		s, transport := newTestSentry(t, WithSentryUser(func(ctx context.Context) (sentry.User, bool) {
+			return sentry.User{ID: "user-1"}, true
+		}))
+
+		client, mockServer, cleanup := setupTestServer(t, s.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, fmt.Errorf("random error"))
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer token", "x-request-id", "abc")
+		_, err := client.Endpoint(ctx, &internal.Input{Value: "Hello", Secret: "password"})
+		assert.NotNil(t, err)
+
+		events := transport.Events()
+		if !assert.Len(t, events, 1) {
+			return
+		}
+		event := events[0]
+
+		assert.Equal(t, sentry.LevelError, event.Level)
+		assert.Equal(t, "random error", event.Exception[len(event.Exception)-1].Value)
+		assert.Equal(t, "user-1", event.User.ID)
+		assert.Equal(t, []string{"/internal.TestService/Endpoint", "Unknown"}, event.Fingerprint)
+		assert.Equal(t, "/internal.TestService/Endpoint", event.Tags["grpc.method"])
+		assert.Equal(t, "Unknown", event.Tags["grpc.code"])
+
+		grpcContext := event.Contexts["grpc"]
+		assert.Equal(t, "/internal.TestService/Endpoint", grpcContext["method"])
+
+		var request map[string]string
+		err = json.Unmarshal(grpcContext["request"].(json.RawMessage), &request)
+		assert.Nil(t, err)
+		assert.Equal(t, map[string]string{"value": "Hello", "secret": "[REDACTED]"}, request)
+
+		md := grpcContext["metadata"].(map[string]string)
+		assert.Equal(t, "[REDACTED]", md["authorization"])
+		assert.Equal(t, "abc", md["x-request-id"])
+	})
+
+	t.Run("groups events by method and status code", func(t *testing.T) {
+		s, transport := newTestSentry(t)
+
+		client, mockServer, cleanup := setupTestServer(t, s.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, status.Error(codes.Unavailable, "database is down"))
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.NotNil(t, err)
+
+		events := transport.Events()
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, []string{"/internal.TestService/Endpoint", "Unavailable"}, events[0].Fingerprint)
+			// there is no user without a client certificate
+			assert.Empty(t, events[0].User.ID)
+		}
+	})
+
+	t.Run("skips application errors", func(t *testing.T) {
+		s, transport := newTestSentry(t)
+
+		client, mockServer, cleanup := setupTestServer(t, NewErrorInterceptor(), s.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, &testApplicationError{message: "not found", grpcCode: codes.NotFound, code: "NOT_FOUND"})
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		assert.Empty(t, transport.Events())
+	})
+
+	t.Run("reports recovered panics with their stack", func(t *testing.T) {
+		s, transport := newTestSentry(t)
+
+		client, mockServer, cleanup := setupTestServer(t, s.UnaryInterceptor(), RecoverInterceptor)
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(mock.Arguments) {
+			panic("something went wrong")
+		})
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.NotNil(t, err)
+
+		events := transport.Events()
+		if !assert.Len(t, events, 1) {
+			return
+		}
+		event := events[0]
+
+		assert.Equal(t, sentry.LevelFatal, event.Level)
+
+		exception := event.Exception[len(event.Exception)-1]
+		assert.Equal(t, "/internal.TestService/Endpoint panicked: something went wrong", exception.Value)
+		if assert.NotNil(t, exception.Mechanism) {
+			assert.False(t, *exception.Mechanism.Handled)
+		}
+
+		// the stack is the one of the handler that panicked, not the one of the interceptor
+		inHandler := false
+		for _, frame := range exception.Stacktrace.Frames {
+			inHandler = inHandler || strings.HasPrefix(frame.Function, "TestSentry.")
+		}
+		assert.True(t, inHandler)
+	})
+
+	t.Run("reports stream errors", func(t *testing.T) {
+		s, transport := newTestSentry(t)
+
+		client, mockServer, cleanup := setupTestServerWithOptions(t, grpc.StreamInterceptor(s.StreamInterceptor()))
+		defer cleanup()
+
+		mockServer.On("Stream", mock.Anything).Run(func(args mock.Arguments) {
+			stream := args.Get(0).(internal.TestService_StreamServer)
+			sentry.GetHubFromContext(stream.Context()).Scope().SetTag("handler", "stream")
+		}).Return(fmt.Errorf("random error"))
+
+		stream, err := client.Stream(context.Background())
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.NotNil(t, err)
+
+		assert.Eventually(t, func() bool {
+			return len(transport.Events()) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		event := transport.Events()[0]
+		assert.Equal(t, []string{"/internal.TestService/Stream", "Unknown"}, event.Fingerprint)
+		// tags set by the handler are reported
+		assert.Equal(t, "stream", event.Tags["handler"])
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := NewSentry(WithSentryHub(nil))
+		assert.NotNil(t, err)
+
+		_, err = NewSentry(WithSentryUser(nil))
+		assert.NotNil(t, err)
+
+		_, err = NewSentry(WithSentrySampleRate(1.5, "/internal.TestService/Endpoint"))
+		assert.NotNil(t, err)
+
+		_, err = NewSentry(WithSentrySampleRate(0.5))
+		assert.NotNil(t, err)
+	})
+}
+
+// sentryEvents returns the events of the given type, "" for errors.
+func sentryEvents(transport *fakeSentryTransport, eventType string) []*sentry.Event {
+	var events []*sentry.Event
+	for _, event := range transport.Events() {
+		if event.Type == eventType {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func TestSentryTransactions(t *testing.T) {
+	t.Run("sends a transaction for each request", func(t *testing.T) {
+		s, transport := newTestSentryTracing(t)
+
+		client, mockServer, cleanup := setupTestServer(t, s.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			ctx := args.Get(0).(context.Context)
+			span := sentry.StartSpan(ctx, "db.query")
+			span.Finish()
+		}).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		transactions := sentryEvents(transport, "transaction")
+		if !assert.Len(t, transactions, 1) {
+			return
+		}
+		transaction := transactions[0]
+
+		assert.Equal(t, "/internal.TestService/Endpoint", transaction.Transaction)
+		assert.Equal(t, sentry.SourceRoute, transaction.TransactionInfo.Source)
+		assert.Equal(t, "grpc.server", transaction.Contexts["trace"]["op"])
+		assert.Equal(t, sentry.SpanStatusOK, transaction.Contexts["trace"]["status"])
+		assert.Equal(t, "OK", transaction.Tags["grpc.code"])
+		// spans started by the handler are part of the transaction
+		if assert.Len(t, transaction.Spans, 1) {
+			assert.Equal(t, "db.query", transaction.Spans[0].Op)
+		}
+	})
+
+	t.Run("sets the status from the status code and links errors", func(t *testing.T) {
+		s, transport := newTestSentryTracing(t)
+
+		client, mockServer, cleanup := setupTestServer(t, s.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, status.Error(codes.Unavailable, "database is down"))
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.NotNil(t, err)
+
+		transactions := sentryEvents(transport, "transaction")
+		reported := sentryEvents(transport, "")
+		if !assert.Len(t, transactions, 1) || !assert.Len(t, reported, 1) {
+			return
+		}
+
+		assert.Equal(t, sentry.SpanStatusUnavailable, transactions[0].Contexts["trace"]["status"])
+		assert.Equal(t, transactions[0].Contexts["trace"]["trace_id"], reported[0].Contexts["trace"]["trace_id"])
+	})
+
+	t.Run("continues the trace of the client", func(t *testing.T) {
+		s, transport := newTestSentryTracing(t)
+
+		client, mockServer, cleanup := setupTestServer(t, s.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		ctx := metadata.AppendToOutgoingContext(
+			context.Background(),
+			"sentry-trace", "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+			"baggage", "sentry-trace_id=4bf92f3577b34da6a3ce929d0e0e4736,sentry-release=1.0.0",
+		)
+		_, err := client.Endpoint(ctx, &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		transactions := sentryEvents(transport, "transaction")
+		if !assert.Len(t, transactions, 1) {
+			return
+		}
+
+		trace := transactions[0].Contexts["trace"]
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fmt.Sprint(trace["trace_id"]))
+		assert.Equal(t, "00f067aa0ba902b7", fmt.Sprint(trace["parent_span_id"]))
+	})
+
+	t.Run("samples methods with their sample rate", func(t *testing.T) {
+		s, transport := newTestSentryTracing(t, WithSentrySampleRate(0, "/internal.TestService/Endpoint"))
+
+		client, mockServer, cleanup := setupTestServer(t, s.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+		assert.Empty(t, sentryEvents(transport, "transaction"))
+
+		// the sampling decision of the client takes precedence
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "sentry-trace", "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1")
+		_, err = client.Endpoint(ctx, &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+		assert.Len(t, sentryEvents(transport, "transaction"), 1)
+	})
+
+	t.Run("are disabled by default", func(t *testing.T) {
+		s, transport := newTestSentryWithClientOptions(t, sentry.ClientOptions{EnableTracing: true, TracesSampleRate: 1})
+
+		client, mockServer, cleanup := setupTestServer(t, s.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+		assert.Empty(t, transport.Events())
+	})
+
+	t.Run("sends a transaction for each stream", func(t *testing.T) {
+		s, transport := newTestSentryTracing(t)
+
+		client, mockServer, cleanup := setupTestServerWithOptions(t, grpc.StreamInterceptor(s.StreamInterceptor()))
+		defer cleanup()
+
+		mockServer.On("Stream", mock.Anything).Return(status.Error(codes.Canceled, "canceled"))
+
+		stream, err := client.Stream(context.Background())
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.NotNil(t, err)
+
+		assert.Eventually(t, func() bool {
+			return len(sentryEvents(transport, "transaction")) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		transaction := sentryEvents(transport, "transaction")[0]
+		assert.Equal(t, "/internal.TestService/Stream", transaction.Transaction)
+		assert.Equal(t, sentry.SpanStatusCanceled, transaction.Contexts["trace"]["status"])
+	})
+}
@@ -0,0 +1,52 @@
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// DrainTimeoutError is returned by Stop when some requests were still running
+// after the drain timeout, and were interrupted.
+type DrainTimeoutError struct {
+	Timeout     time.Duration
+	Interrupted int64
+}
+
+func (e *DrainTimeoutError) Error() string {
+	return fmt.Sprintf("gRPC server did not drain within %s: %d requests were interrupted", e.Timeout, e.Interrupted)
+}
+
+// requestContext stores the logger and the redactor of the server in the context of a request.
+func (l *listener) requestContext(ctx context.Context) context.Context {
+	ctx = ContextWithLogger(ctx, l.logger)
+	return context.WithValue(ctx, redactorKey{}, l.redactor)
+}
+
+func (l *listener) trackUnary(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (resp interface{}, err error) {
+	atomic.AddInt64(&l.activeRequests, 1)
+	defer atomic.AddInt64(&l.activeRequests, -1)
+
+	ctx = context.WithValue(l.requestContext(ctx), messageSizesKey{}, &messageSizes{})
+	return handler(ctx, req)
+}
+
+func (l *listener) trackStream(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	atomic.AddInt64(&l.activeRequests, 1)
+	defer atomic.AddInt64(&l.activeRequests, -1)
+
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: l.requestContext(ss.Context())})
+}
@@ -0,0 +1,145 @@
+package grpc_server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestStop(t *testing.T) {
+	t.Run("waits for running requests", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener), WithDrainTimeout(5*time.Second))
+		assert.Nil(t, err)
+
+		mockServer := &internal.MockTestServiceServer{}
+		internal.RegisterTestServiceServer(server.GetServer(), mockServer)
+
+		received := make(chan struct{})
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(_ mock.Arguments) {
+			close(received)
+			time.Sleep(100 * time.Millisecond)
+		}).Return(&internal.Output{Value: "World"}, nil)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+
+		cc, err := grpc.Dial(tcpListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		requestErr := make(chan error, 1)
+		go func() {
+			_, err := internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+			requestErr <- err
+		}()
+
+		<-received
+
+		err = server.Stop()
+		assert.Nil(t, err)
+		assert.Nil(t, <-requestErr)
+	})
+
+	t.Run("interrupts requests after the drain timeout", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener), WithDrainTimeout(100*time.Millisecond))
+		assert.Nil(t, err)
+
+		mockServer := &internal.MockTestServiceServer{}
+		internal.RegisterTestServiceServer(server.GetServer(), mockServer)
+
+		received := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(_ mock.Arguments) {
+			close(received)
+			<-release
+		}).Return(&internal.Output{Value: "World"}, nil)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+
+		cc, err := grpc.Dial(tcpListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		requestErr := make(chan error, 1)
+		go func() {
+			_, err := internal.NewTestServiceClient(cc).Endpoint(context.Background(), &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+			requestErr <- err
+		}()
+
+		<-received
+
+		err = server.Stop()
+
+		var drainTimeoutError *DrainTimeoutError
+		assert.ErrorAs(t, err, &drainTimeoutError)
+		assert.Equal(t, int64(1), drainTimeoutError.Interrupted)
+		assert.NotNil(t, <-requestErr)
+	})
+
+	t.Run("reports not serving during the pre-stop delay", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener), WithPreStopDelay(time.Second))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+
+		cc, err := grpc.Dial(tcpListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		healthClient := healthgrpc.NewHealthClient(cc)
+
+		_, err = healthClient.Check(context.Background(), &healthgrpc.HealthCheckRequest{}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+
+		stopErr := make(chan error, 1)
+		go func() {
+			stopErr <- server.Stop()
+		}()
+
+		assert.Eventually(t, func() bool {
+			res, err := healthClient.Check(context.Background(), &healthgrpc.HealthCheckRequest{})
+			return err == nil && res.Status == healthgrpc.HealthCheckResponse_NOT_SERVING
+		}, time.Second, 10*time.Millisecond)
+
+		assert.Nil(t, <-stopErr)
+	})
+
+	t.Run("stops the server once", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(tcpListener), WithPreStopDelay(200*time.Millisecond))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+
+		err = server.Stop()
+		assert.Nil(t, err)
+
+		start := time.Now()
+		err = server.Stop()
+		assert.Nil(t, err)
+		assert.Less(t, time.Since(start), 200*time.Millisecond)
+	})
+}
@@ -0,0 +1,56 @@
+package grpc_server
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger creates a logger that writes to the given slog logger.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Enabled(ctx context.Context, level Level) bool {
+	return l.logger.Enabled(ctx, level.slogLevel())
+}
+
+func (l *slogLogger) Log(ctx context.Context, level Level, msg string, fields Fields) {
+	l.logger.LogAttrs(ctx, level.slogLevel(), msg, slogAttrs(fields)...)
+}
+
+func (l *slogLogger) With(fields Fields) Logger {
+	return &slogLogger{logger: slog.New(l.logger.Handler().WithAttrs(slogAttrs(fields)))}
+}
+
+func (l Level) slogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// slogAttrs converts fields to attributes, sorted by key so that records are stable.
+func slogAttrs(fields Fields) []slog.Attr {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.Any(key, fields[key]))
+	}
+	return attrs
+}
@@ -20,11 +20,30 @@ func StatusInterceptor(
 		return resp, nil
 	}
 
+	return nil, statusError(err)
+}
+
+func StatusStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	err := handler(srv, ss)
+
+	if err == nil {
+		return nil
+	}
+
+	return statusError(err)
+}
+
+func statusError(err error) error {
 	st := status.Convert(err)
 
 	if st.Code() == codes.Unknown {
-		return nil, status.New(codes.Internal, st.Message()).Err()
+		return status.New(codes.Internal, st.Message()).Err()
 	} else {
-		return nil, st.Err()
+		return st.Err()
 	}
 }
@@ -74,4 +74,24 @@ func TestStatusInterceptor(t *testing.T) {
 		assert.Equal(t, codes.Internal, grpcErr.GRPCStatus().Code())
 		assert.Nil(t, md["code"])
 	})
+
+	t.Run("wraps other errors on streams", func(t *testing.T) {
+		client, mockServer, cleanup := setupTestStreamServer(t, StatusStreamInterceptor)
+		defer cleanup()
+
+		ctx := context.Background()
+
+		mockServer.On("Stream", mock.Anything).Return(fmt.Errorf("random error"))
+
+		stream, err := client.Stream(ctx)
+		assert.Nil(t, err)
+
+		_, err = stream.Recv()
+
+		assert.NotNil(t, err)
+		grpcErr, ok := err.(GRPCStatus)
+		assert.True(t, ok)
+		assert.Equal(t, "random error", grpcErr.GRPCStatus().Message())
+		assert.Equal(t, codes.Internal, grpcErr.GRPCStatus().Code())
+	})
 }
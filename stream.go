@@ -0,0 +1,18 @@
+package grpc_server
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// contextServerStream replaces the context of a server stream,
+// so that stream interceptors can pass values to the stream handler.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
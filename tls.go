@@ -0,0 +1,171 @@
+package grpc_server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type tlsOptions struct {
+	config       *tls.Config
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	minVersion   uint16
+	cipherSuites []uint16
+
+	reloadInterval time.Duration
+}
+
+// WithTLSConfig serves TLS connections using the given configuration.
+//
+// The configuration is cloned, and can be combined with the other TLS options,
+// which take precedence over it.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *serverConfig) error {
+		if config == nil {
+			return errors.New("TLS config must not be nil")
+		}
+		c.tlsOptions().config = config.Clone()
+		return nil
+	}
+}
+
+// WithTLSCertificate serves TLS connections using the certificate
+// and private key stored in the given PEM files.
+func WithTLSCertificate(certFile, keyFile string) Option {
+	return func(c *serverConfig) error {
+		if certFile == "" || keyFile == "" {
+			return errors.New("TLS certificate and key files must not be empty")
+		}
+		c.tlsOptions().certFile = certFile
+		c.tlsOptions().keyFile = keyFile
+		return nil
+	}
+}
+
+// WithClientCA enables mutual TLS: clients must present a certificate
+// signed by one of the certificate authorities stored in the given PEM file.
+func WithClientCA(caFile string) Option {
+	return func(c *serverConfig) error {
+		if caFile == "" {
+			return errors.New("client CA file must not be empty")
+		}
+		c.tlsOptions().clientCAFile = caFile
+		return nil
+	}
+}
+
+// WithTLSMinVersion sets the minimum TLS version accepted by the server,
+// e.g. tls.VersionTLS13. The default is TLS 1.2.
+func WithTLSMinVersion(version uint16) Option {
+	return func(c *serverConfig) error {
+		switch version {
+		case tls.VersionTLS12, tls.VersionTLS13:
+		default:
+			return fmt.Errorf("unsupported minimum TLS version %#04x", version)
+		}
+		c.tlsOptions().minVersion = version
+		return nil
+	}
+}
+
+// WithTLSCipherSuites restricts the cipher suites accepted by the server
+// for TLS 1.2 connections. TLS 1.3 cipher suites are not configurable.
+//
+// Only the secure cipher suites returned by tls.CipherSuites are accepted.
+func WithTLSCipherSuites(suites ...uint16) Option {
+	return func(c *serverConfig) error {
+		secure := make(map[uint16]bool)
+		for _, suite := range tls.CipherSuites() {
+			secure[suite.ID] = true
+		}
+		for _, suite := range suites {
+			if !secure[suite] {
+				return fmt.Errorf("cipher suite %s is not allowed", tls.CipherSuiteName(suite))
+			}
+		}
+		c.tlsOptions().cipherSuites = suites
+		return nil
+	}
+}
+
+func (c *serverConfig) tlsOptions() *tlsOptions {
+	if c.tls == nil {
+		c.tls = &tlsOptions{}
+	}
+	return c.tls
+}
+
+// build creates the TLS config of a server, and the reloader of its certificate files, if any.
+// The reloader metrics use the given namespace and const labels.
+func (o *tlsOptions) build(namespace string, constLabels prometheus.Labels) (*tls.Config, *certificateReloader, error) {
+	config := o.config
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	if o.minVersion != 0 {
+		config.MinVersion = o.minVersion
+	} else if config.MinVersion < tls.VersionTLS12 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	if o.cipherSuites != nil {
+		config.CipherSuites = o.cipherSuites
+	}
+
+	if o.certFile == "" && o.clientCAFile == "" {
+		if o.reloadInterval > 0 {
+			return nil, nil, errors.New("TLS reload requires certificate or client CA files")
+		}
+		if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+			return nil, nil, errors.New("TLS requires a server certificate")
+		}
+		return config, nil, nil
+	}
+
+	reloader := newCertificateReloader(o.certFile, o.keyFile, o.clientCAFile, o.reloadInterval, namespace, constLabels)
+	if err := reloader.reload(); err != nil {
+		return nil, nil, err
+	}
+
+	if o.certFile != "" {
+		config.Certificates = nil
+		config.GetCertificate = reloader.getCertificate
+	} else if len(config.Certificates) == 0 && config.GetCertificate == nil {
+		return nil, nil, errors.New("TLS requires a server certificate")
+	}
+
+	if o.clientCAFile != "" {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = reloader.getClientCAs()
+
+		// the config returned for each handshake does not go through credentials.NewTLS,
+		// so it needs the HTTP/2 protocol explicitly
+		if !slicesContain(config.NextProtos, "h2") {
+			config.NextProtos = append(config.NextProtos, "h2")
+		}
+
+		handshakeConfig := config.Clone()
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientConfig := handshakeConfig.Clone()
+			clientConfig.ClientCAs = reloader.getClientCAs()
+			return clientConfig, nil
+		}
+	}
+
+	return config, reloader, nil
+}
+
+func slicesContain(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
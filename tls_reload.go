@@ -0,0 +1,269 @@
+package grpc_server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithTLSReloadInterval makes the server check the certificate, key and client CA
+// files for changes at the given interval. Changed files are loaded and used
+// for new handshakes, without restarting the server.
+//
+// Hot reload only applies to files configured with WithTLSCertificate and WithClientCA.
+func WithTLSReloadInterval(interval time.Duration) Option {
+	return func(c *serverConfig) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid TLS reload interval %s", interval)
+		}
+		c.tlsOptions().reloadInterval = interval
+		return nil
+	}
+}
+
+// certificateReloader loads the certificate and client CA files,
+// and swaps them atomically when their content changes.
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+
+	certificate atomic.Pointer[tls.Certificate]
+	clientCAs   atomic.Pointer[x509.CertPool]
+	checksum    [sha256.Size]byte
+
+	expiry        *prometheus.GaugeVec
+	reloadTime    prometheus.Gauge
+	reloadSuccess prometheus.Gauge
+	reloadCounter *prometheus.CounterVec
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+// tlsMetricLabels returns the namespace and the const labels of the TLS metrics of a server.
+// They use the namespace and the const labels of the server metrics, if any,
+// and the address of the server, so that the metrics of two servers do not collide.
+func tlsMetricLabels(metrics *Metrics, address string) (string, prometheus.Labels) {
+	namespace := defaultMetricsConfig().namespace
+	labels := prometheus.Labels{}
+	if metrics != nil {
+		namespace = metrics.namespace
+		for name, value := range metrics.constLabels {
+			labels[name] = value
+		}
+	}
+	if _, ok := labels["address"]; !ok {
+		labels["address"] = address
+	}
+	return namespace, labels
+}
+
+func newCertificateReloader(
+	certFile, keyFile, caFile string,
+	interval time.Duration,
+	namespace string,
+	constLabels prometheus.Labels,
+) *certificateReloader {
+	return &certificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		interval: interval,
+		expiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "tls",
+			ConstLabels: constLabels,
+			Name:        "certificate_expiry_timestamp_seconds",
+			Help:        "Expiration time of the loaded TLS certificates, in seconds since the epoch",
+		}, []string{"certificate"}),
+		reloadTime: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "tls",
+			ConstLabels: constLabels,
+			Name:        "last_reload_timestamp_seconds",
+			Help:        "Time of the last attempt to load changed TLS certificates, in seconds since the epoch",
+		}),
+		reloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "tls",
+			ConstLabels: constLabels,
+			Name:        "last_reload_success",
+			Help:        "Whether the last attempt to load changed TLS certificates succeeded",
+		}),
+		reloadCounter: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "tls",
+			ConstLabels: constLabels,
+			Name:        "reloads_total",
+			Help:        "Counter for attempts to load changed TLS certificates",
+		}, []string{"result"}),
+		stop: make(chan struct{}),
+	}
+}
+
+func (r *certificateReloader) collectors() []prometheus.Collector {
+	return []prometheus.Collector{r.expiry, r.reloadTime, r.reloadSuccess, r.reloadCounter}
+}
+
+func (r *certificateReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.certificate.Load(), nil
+}
+
+func (r *certificateReloader) getClientCAs() *x509.CertPool {
+	return r.clientCAs.Load()
+}
+
+// reload loads the files if their content changed since the last attempt.
+// When loading fails, the previous certificates are kept.
+func (r *certificateReloader) reload() error {
+	changed, err := r.load()
+	if !changed && err == nil {
+		return nil
+	}
+
+	r.reloadTime.SetToCurrentTime()
+
+	if err != nil {
+		r.reloadSuccess.Set(0)
+		r.reloadCounter.With(prometheus.Labels{"result": "failure"}).Inc()
+		return err
+	}
+
+	r.reloadSuccess.Set(1)
+	r.reloadCounter.With(prometheus.Labels{"result": "success"}).Inc()
+	return nil
+}
+
+func (r *certificateReloader) load() (changed bool, err error) {
+	var certPEM, keyPEM, caPEM []byte
+
+	if r.certFile != "" {
+		if certPEM, err = os.ReadFile(r.certFile); err != nil {
+			return false, fmt.Errorf("failed to read TLS certificate: %w", err)
+		}
+		if keyPEM, err = os.ReadFile(r.keyFile); err != nil {
+			return false, fmt.Errorf("failed to read TLS key: %w", err)
+		}
+	}
+
+	if r.caFile != "" {
+		if caPEM, err = os.ReadFile(r.caFile); err != nil {
+			return false, fmt.Errorf("failed to read CA file: %w", err)
+		}
+	}
+
+	checksum := sha256.Sum256(bytes.Join([][]byte{certPEM, keyPEM, caPEM}, []byte{0}))
+	if checksum == r.checksum {
+		return false, nil
+	}
+	// files that failed to load are not loaded again until they change
+	r.checksum = checksum
+
+	var certificate tls.Certificate
+	if r.certFile != "" {
+		certificate, err = tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return true, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return true, fmt.Errorf("failed to parse TLS certificate: %w", err)
+		}
+	}
+
+	var caCertificates []*x509.Certificate
+	if r.caFile != "" {
+		caCertificates, err = parseCertificates(caPEM)
+		if err != nil {
+			return true, fmt.Errorf("failed to load CA file %s: %w", r.caFile, err)
+		}
+	}
+
+	if r.certFile != "" {
+		r.certificate.Store(&certificate)
+		r.expiry.With(prometheus.Labels{"certificate": "server"}).Set(float64(certificate.Leaf.NotAfter.Unix()))
+	}
+
+	if r.caFile != "" {
+		pool := x509.NewCertPool()
+		expiry := caCertificates[0].NotAfter
+		for _, caCertificate := range caCertificates {
+			pool.AddCert(caCertificate)
+			if caCertificate.NotAfter.Before(expiry) {
+				expiry = caCertificate.NotAfter
+			}
+		}
+		r.clientCAs.Store(pool)
+		r.expiry.With(prometheus.Labels{"certificate": "client_ca"}).Set(float64(expiry.Unix()))
+	}
+
+	return true, nil
+}
+
+func (r *certificateReloader) start(logger Logger) {
+	if r.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if err := r.reload(); err != nil {
+					logf(context.Background(), logger, LevelError, "failed to reload TLS certificates: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *certificateReloader) close() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	var certificates []*x509.Certificate
+
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+
+	return certificates, nil
+}
@@ -0,0 +1,152 @@
+package grpc_server
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials"
+)
+
+func peerCertificateExpiry(t *testing.T, addr string, config *tls.Config) time.Time {
+	conn, err := tls.Dial("tcp", addr, config)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].NotAfter
+}
+
+func TestTLSReload(t *testing.T) {
+	t.Run("reloads changed certificates", func(t *testing.T) {
+		dir := t.TempDir()
+		ca := newTestCertificateAuthority(t, dir)
+		oldExpiry := time.Now().Add(time.Hour).Truncate(time.Second)
+		serverCert := ca.issue(t, dir, "server", oldExpiry, nil)
+
+		server, addr, cleanup := startTLSTestServer(
+			t,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithTLSReloadInterval(10*time.Millisecond),
+		)
+		defer cleanup()
+
+		clientConfig := &tls.Config{RootCAs: ca.pool(), NextProtos: []string{"h2"}}
+
+		assert.True(t, oldExpiry.Equal(peerCertificateExpiry(t, addr, clientConfig)))
+		assert.Equal(t, float64(oldExpiry.Unix()), metricValue(t, server.GetMetrics(), "grpc_tls_certificate_expiry_timestamp_seconds", prometheus.Labels{"certificate": "server"}))
+
+		newExpiry := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+		ca.issue(t, dir, "server", newExpiry, nil)
+
+		assert.Eventually(t, func() bool {
+			return peerCertificateExpiry(t, addr, clientConfig).Equal(newExpiry)
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, float64(newExpiry.Unix()), metricValue(t, server.GetMetrics(), "grpc_tls_certificate_expiry_timestamp_seconds", prometheus.Labels{"certificate": "server"}))
+		assert.Equal(t, float64(1), metricValue(t, server.GetMetrics(), "grpc_tls_last_reload_success", nil))
+		assert.Equal(t, float64(2), metricValue(t, server.GetMetrics(), "grpc_tls_reloads_total", prometheus.Labels{"result": "success"}))
+	})
+
+	t.Run("keeps the previous certificates when reloading fails", func(t *testing.T) {
+		dir := t.TempDir()
+		ca := newTestCertificateAuthority(t, dir)
+		serverCert := ca.issue(t, dir, "server", time.Now().Add(time.Hour), nil)
+
+		server, addr, cleanup := startTLSTestServer(
+			t,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithTLSReloadInterval(10*time.Millisecond),
+		)
+		defer cleanup()
+
+		err := os.WriteFile(serverCert.certFile, []byte("not a certificate"), 0o600)
+		assert.Nil(t, err)
+
+		assert.Eventually(t, func() bool {
+			return metricValue(t, server.GetMetrics(), "grpc_tls_last_reload_success", nil) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, float64(1), metricValue(t, server.GetMetrics(), "grpc_tls_reloads_total", prometheus.Labels{"result": "failure"}))
+
+		err = checkHealth(addr, credentials.NewTLS(&tls.Config{RootCAs: ca.pool()}))
+		assert.Nil(t, err)
+	})
+
+	t.Run("reloads changed client CAs", func(t *testing.T) {
+		dir := t.TempDir()
+		ca := newTestCertificateAuthority(t, dir)
+		serverCert := ca.issue(t, dir, "server", time.Now().Add(time.Hour), nil)
+
+		_, addr, cleanup := startTLSTestServer(
+			t,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithClientCA(ca.file),
+			WithTLSReloadInterval(10*time.Millisecond),
+		)
+		defer cleanup()
+
+		newCA := newTestCertificateAuthority(t, t.TempDir())
+		clientCert := newCA.issue(t, t.TempDir(), "client", time.Now().Add(time.Hour), nil)
+
+		clientCreds := credentials.NewTLS(&tls.Config{
+			RootCAs:      ca.pool(),
+			Certificates: []tls.Certificate{clientCert.certificate},
+		})
+
+		err := checkHealth(addr, clientCreds)
+		assert.NotNil(t, err)
+
+		caPEM, err := os.ReadFile(newCA.file)
+		assert.Nil(t, err)
+		err = os.WriteFile(ca.file, caPEM, 0o600)
+		assert.Nil(t, err)
+
+		assert.Eventually(t, func() bool {
+			return checkHealth(addr, clientCreds) == nil
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("labels the metrics of each server", func(t *testing.T) {
+		dir := t.TempDir()
+		ca := newTestCertificateAuthority(t, dir)
+		serverCert := ca.issue(t, dir, "server", time.Now().Add(time.Hour), nil)
+
+		registry := prometheus.NewPedanticRegistry()
+
+		for _, namespace := range []string{"grpc", "grpc", "app"} {
+			tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.Nil(t, err)
+			defer tcpListener.Close()
+
+			metrics, err := NewMetrics(WithMetricsNamespace(namespace))
+			assert.Nil(t, err)
+
+			server, err := NewServer(
+				WithListener(tcpListener),
+				WithMetrics(metrics),
+				WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			)
+			assert.Nil(t, err)
+
+			assert.Equal(t, float64(1), metricValue(t, server.GetMetrics(), namespace+"_tls_reloads_total", prometheus.Labels{
+				"address": tcpListener.Addr().String(),
+				"result":  "success",
+			}))
+
+			// the server metrics share their names, only the TLS metrics are labelled with the address
+			for _, collector := range server.(*listener).reloader.collectors() {
+				err = registry.Register(collector)
+				assert.Nil(t, err)
+			}
+		}
+	})
+
+	t.Run("requires certificate files", func(t *testing.T) {
+		_, err := NewServer(WithTLSConfig(&tls.Config{}), WithTLSReloadInterval(time.Second))
+		assert.NotNil(t, err)
+	})
+}
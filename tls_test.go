@@ -0,0 +1,246 @@
+package grpc_server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testCertificateAuthority struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	file        string
+}
+
+type testCertificate struct {
+	certificate tls.Certificate
+	certFile    string
+	keyFile     string
+}
+
+func newTestCertificateAuthority(t *testing.T, dir string) *testCertificateAuthority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+
+	certificate, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	file := filepath.Join(dir, "ca.pem")
+	writePEM(t, file, "CERTIFICATE", der)
+
+	return &testCertificateAuthority{certificate: certificate, key: key, file: file}
+}
+
+// issue creates a certificate signed by the CA, and stores it in dir
+// as name.pem and name-key.pem.
+func (ca *testCertificateAuthority) issue(
+	t *testing.T,
+	dir string,
+	name string,
+	notAfter time.Time,
+	modify func(template *x509.Certificate),
+) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if modify != nil {
+		modify(template)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.certificate, &key.PublicKey, ca.key)
+	assert.Nil(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.Nil(t, err)
+
+	return &testCertificate{certificate: certificate, certFile: certFile, keyFile: keyFile}
+}
+
+func (ca *testCertificateAuthority) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.certificate)
+	return pool
+}
+
+func writePEM(t *testing.T, file string, blockType string, der []byte) {
+	// write to a temporary file and rename it, so that readers never see a partial file
+	tmp := file + ".tmp"
+	err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	assert.Nil(t, err)
+	err = os.Rename(tmp, file)
+	assert.Nil(t, err)
+}
+
+func startTLSTestServer(t *testing.T, opts ...Option) (server GrpcServer, addr string, cleanup func()) {
+	server, err := NewServer(append([]Option{WithAddress("tcp", "127.0.0.1:0")}, opts...)...)
+	assert.Nil(t, err)
+
+	err = server.Listen()
+	assert.Nil(t, err)
+
+	return server, server.Addr().String(), func() {
+		err := server.Stop()
+		assert.Nil(t, err)
+	}
+}
+
+func checkHealth(addr string, creds credentials.TransportCredentials) error {
+	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = healthgrpc.NewHealthClient(cc).Check(ctx, &healthgrpc.HealthCheckRequest{})
+	return err
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCertificateAuthority(t, dir)
+	serverCert := ca.issue(t, dir, "server", time.Now().Add(time.Hour), nil)
+	clientCert := ca.issue(t, dir, "client", time.Now().Add(time.Hour), nil)
+
+	t.Run("serves TLS with certificate files", func(t *testing.T) {
+		_, addr, cleanup := startTLSTestServer(t, WithTLSCertificate(serverCert.certFile, serverCert.keyFile))
+		defer cleanup()
+
+		err := checkHealth(addr, credentials.NewTLS(&tls.Config{RootCAs: ca.pool()}))
+		assert.Nil(t, err)
+
+		err = checkHealth(addr, insecure.NewCredentials())
+		assert.NotNil(t, err)
+	})
+
+	t.Run("serves TLS with a TLS config", func(t *testing.T) {
+		_, addr, cleanup := startTLSTestServer(t, WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{serverCert.certificate}}))
+		defer cleanup()
+
+		err := checkHealth(addr, credentials.NewTLS(&tls.Config{RootCAs: ca.pool()}))
+		assert.Nil(t, err)
+	})
+
+	t.Run("requires client certificates with mutual TLS", func(t *testing.T) {
+		_, addr, cleanup := startTLSTestServer(
+			t,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithClientCA(ca.file),
+		)
+		defer cleanup()
+
+		err := checkHealth(addr, credentials.NewTLS(&tls.Config{RootCAs: ca.pool()}))
+		assert.NotNil(t, err)
+
+		err = checkHealth(addr, credentials.NewTLS(&tls.Config{
+			RootCAs:      ca.pool(),
+			Certificates: []tls.Certificate{clientCert.certificate},
+		}))
+		assert.Nil(t, err)
+	})
+
+	t.Run("enforces the minimum TLS version", func(t *testing.T) {
+		_, addr, cleanup := startTLSTestServer(
+			t,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithTLSMinVersion(tls.VersionTLS13),
+		)
+		defer cleanup()
+
+		err := checkHealth(addr, credentials.NewTLS(&tls.Config{RootCAs: ca.pool(), MaxVersion: tls.VersionTLS12}))
+		assert.NotNil(t, err)
+
+		err = checkHealth(addr, credentials.NewTLS(&tls.Config{RootCAs: ca.pool()}))
+		assert.Nil(t, err)
+	})
+
+	t.Run("enforces the cipher suites", func(t *testing.T) {
+		_, addr, cleanup := startTLSTestServer(
+			t,
+			WithTLSCertificate(serverCert.certFile, serverCert.keyFile),
+			WithTLSCipherSuites(tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384),
+		)
+		defer cleanup()
+
+		err := checkHealth(addr, credentials.NewTLS(&tls.Config{
+			RootCAs:      ca.pool(),
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		}))
+		assert.NotNil(t, err)
+
+		err = checkHealth(addr, credentials.NewTLS(&tls.Config{
+			RootCAs:      ca.pool(),
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+		}))
+		assert.Nil(t, err)
+	})
+
+	t.Run("rejects invalid configurations", func(t *testing.T) {
+		_, err := NewServer(WithTLSCertificate(filepath.Join(dir, "missing.pem"), serverCert.keyFile))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithTLSCertificate(serverCert.certFile, serverCert.keyFile), WithClientCA(serverCert.keyFile))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithClientCA(ca.file))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithTLSMinVersion(tls.VersionTLS10))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithTLSCipherSuites(tls.TLS_RSA_WITH_RC4_128_SHA))
+		assert.NotNil(t, err)
+	})
+}
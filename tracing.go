@@ -0,0 +1,239 @@
+package grpc_server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Tracing creates OpenTelemetry spans for the RPCs served by a gRPC server.
+//
+// Create it with NewTracing and pass it to the server with WithTracing,
+// or register its interceptors yourself.
+type Tracing struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// TracingOption configures the tracing created by NewTracing.
+type TracingOption func(*tracingConfig) error
+
+type tracingConfig struct {
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+func defaultTracingConfig() *tracingConfig {
+	return &tracingConfig{
+		provider: otel.GetTracerProvider(),
+		propagator: propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{},
+		),
+	}
+}
+
+// WithTracerProvider sets the provider of the tracer that creates the spans.
+// The default is the global tracer provider.
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(c *tracingConfig) error {
+		if provider == nil {
+			return errors.New("tracer provider must not be nil")
+		}
+		c.provider = provider
+		return nil
+	}
+}
+
+// WithPropagator sets the propagator that extracts the trace context from the incoming metadata.
+// The default extracts the W3C traceparent, tracestate and baggage headers.
+func WithPropagator(propagator propagation.TextMapPropagator) TracingOption {
+	return func(c *tracingConfig) error {
+		if propagator == nil {
+			return errors.New("propagator must not be nil")
+		}
+		c.propagator = propagator
+		return nil
+	}
+}
+
+// NewTracing creates the tracing for a gRPC server.
+// It returns an error if an option is invalid.
+func NewTracing(opts ...TracingOption) (*Tracing, error) {
+	config := defaultTracingConfig()
+	for _, opt := range opts {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Tracing{
+		tracer:     config.provider.Tracer(instrumentationName, trace.WithSchemaURL(semconv.SchemaURL)),
+		propagator: config.propagator,
+	}, nil
+}
+
+// WithTracing makes the server create a span for each RPC with the given tracing.
+//
+// The tracing interceptors are registered before the other interceptors,
+// so that the span covers the whole RPC.
+func WithTracing(tracing *Tracing) Option {
+	return func(c *serverConfig) error {
+		if tracing == nil {
+			return errors.New("tracing must not be nil")
+		}
+		c.tracing = tracing
+		return nil
+	}
+}
+
+// UnaryInterceptor returns an interceptor that creates a server span for each request,
+// continuing the trace propagated by the client in the incoming metadata.
+//
+// The span is stored in the context passed to the handler,
+// use trace.SpanFromContext to add attributes and events to it,
+// and baggage.FromContext to read the propagated baggage.
+func (t *Tracing) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		ctx, span := t.start(ctx, newRPCInfo(info.FullMethod, unaryRPC))
+		defer span.End()
+
+		resp, err = handler(ctx, req)
+
+		endSpan(span, err)
+
+		return resp, err
+	}
+}
+
+// StreamInterceptor returns the stream counterpart of UnaryInterceptor.
+func (t *Tracing) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, span := t.start(ss.Context(), newRPCInfo(info.FullMethod, streamRPCType(info)))
+		defer span.End()
+
+		err := handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+
+		endSpan(span, err)
+
+		return err
+	}
+}
+
+func (t *Tracing) start(ctx context.Context, rpc RPCInfo) (context.Context, trace.Span) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = t.propagator.Extract(ctx, metadataCarrier(md))
+
+	// the span name follows the $package.$service/$method convention
+	name := rpc.Service + "/" + rpc.Method
+
+	return t.tracer.Start(
+		ctx,
+		name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(rpcAttributes(rpc)...),
+		trace.WithAttributes(peerAttributes(ctx)...),
+	)
+}
+
+// endSpan records the outcome of an RPC on its span.
+func endSpan(span trace.Span, err error) {
+	if IsApplicationError(err) {
+		recordApplicationError(span, err)
+	}
+
+	code := status.Code(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+
+	if isServerError(code) {
+		span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+	}
+}
+
+// recordApplicationError adds an application error to a span as an exception event.
+func recordApplicationError(span trace.Span, err error) {
+	span.RecordError(err, trace.WithAttributes(
+		semconv.RPCGRPCStatusCodeKey.Int(int(status.Code(err))),
+	))
+}
+
+// isServerError reports whether the status code is an error of the server,
+// following the semantic conventions for gRPC server spans.
+// Other codes are caused by the client, and do not mark the span as failed.
+func isServerError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown,
+		codes.DeadlineExceeded,
+		codes.Unimplemented,
+		codes.Internal,
+		codes.Unavailable,
+		codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+func peerAttributes(ctx context.Context) []attribute.KeyValue {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil
+	}
+
+	attributes := []attribute.KeyValue{semconv.NetworkPeerAddress(host)}
+	if portNumber, err := strconv.Atoi(port); err == nil {
+		attributes = append(attributes, semconv.NetworkPeerPort(portNumber))
+	}
+	return attributes
+}
+
+// metadataCarrier adapts gRPC metadata to the carrier used by OpenTelemetry propagators.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
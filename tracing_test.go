@@ -0,0 +1,228 @@
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/moveaxlab/go-grpc-server/internal"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func newTestTracing(t *testing.T) (*Tracing, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	tracing, err := NewTracing(WithTracerProvider(provider))
+	assert.Nil(t, err)
+
+	return tracing, exporter
+}
+
+func spanAttribute(span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	t.Run("continues the trace of the client", func(t *testing.T) {
+		tracing, exporter := newTestTracing(t)
+
+		client, mockServer, cleanup := setupTestServer(t, tracing.UnaryInterceptor())
+		defer cleanup()
+
+		var handlerContext context.Context
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			handlerContext = args.Get(0).(context.Context)
+		}).Return(&internal.Output{Value: "World"}, nil)
+
+		ctx := metadata.AppendToOutgoingContext(
+			context.Background(),
+			"traceparent", testTraceparent,
+			"tracestate", "vendor=value",
+			"baggage", "tenant=acme",
+		)
+		_, err := client.Endpoint(ctx, &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		spans := exporter.GetSpans()
+		if !assert.Len(t, spans, 1) {
+			return
+		}
+		span := spans[0]
+
+		assert.Equal(t, "internal.TestService/Endpoint", span.Name)
+		assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+		assert.True(t, span.Parent.IsRemote())
+		assert.Equal(t, "vendor=value", span.SpanContext.TraceState().String())
+		assert.Equal(t, otelcodes.Unset, span.Status.Code)
+
+		assert.Equal(t, "grpc", spanAttribute(span, "rpc.system").AsString())
+		assert.Equal(t, "internal.TestService", spanAttribute(span, "rpc.service").AsString())
+		assert.Equal(t, "Endpoint", spanAttribute(span, "rpc.method").AsString())
+		assert.Equal(t, int64(codes.OK), spanAttribute(span, "rpc.grpc.status_code").AsInt64())
+
+		// the handler sees the span and the baggage
+		assert.Equal(t, span.SpanContext.SpanID(), trace.SpanContextFromContext(handlerContext).SpanID())
+		assert.Equal(t, "acme", baggage.FromContext(handlerContext).Member("tenant").Value())
+	})
+
+	t.Run("starts a new trace without a parent", func(t *testing.T) {
+		tracing, exporter := newTestTracing(t)
+
+		client, mockServer, cleanup := setupTestServer(t, tracing.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Nil(t, err)
+
+		spans := exporter.GetSpans()
+		if assert.Len(t, spans, 1) {
+			assert.True(t, spans[0].SpanContext.IsValid())
+			assert.False(t, spans[0].Parent.IsValid())
+		}
+	})
+
+	t.Run("records status codes", func(t *testing.T) {
+		tracing, exporter := newTestTracing(t)
+
+		client, mockServer, cleanup := setupTestServer(t, tracing.UnaryInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, inputWithValue("random")).Return(nil, fmt.Errorf("random error"))
+		mockServer.On("Endpoint", mock.Anything, inputWithValue("invalid")).Return(nil, status.Error(codes.InvalidArgument, "invalid input"))
+
+		_, err := client.Endpoint(context.Background(), &internal.Input{Value: "random"})
+		assert.NotNil(t, err)
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "invalid"})
+		assert.NotNil(t, err)
+
+		spans := exporter.GetSpans()
+		if !assert.Len(t, spans, 2) {
+			return
+		}
+
+		// server errors mark the span as failed
+		assert.Equal(t, int64(codes.Unknown), spanAttribute(spans[0], "rpc.grpc.status_code").AsInt64())
+		assert.Equal(t, otelcodes.Error, spans[0].Status.Code)
+		assert.Equal(t, "random error", spans[0].Status.Description)
+
+		// client errors do not
+		assert.Equal(t, int64(codes.InvalidArgument), spanAttribute(spans[1], "rpc.grpc.status_code").AsInt64())
+		assert.Equal(t, otelcodes.Unset, spans[1].Status.Code)
+	})
+
+	t.Run("records application errors", func(t *testing.T) {
+		tracing, exporter := newTestTracing(t)
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		client, mockServer, cleanup := setupTestServer(t, tracing.UnaryInterceptor(), metrics.ErrorInterceptor())
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(nil, &testApplicationError{message: "not found", grpcCode: codes.NotFound, code: "NOT_FOUND"})
+
+		_, err = client.Endpoint(context.Background(), &internal.Input{Value: "Hello"})
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		spans := exporter.GetSpans()
+		if !assert.Len(t, spans, 1) {
+			return
+		}
+
+		assert.Equal(t, int64(codes.NotFound), spanAttribute(spans[0], "rpc.grpc.status_code").AsInt64())
+		if assert.Len(t, spans[0].Events, 1) {
+			assert.Equal(t, "exception", spans[0].Events[0].Name)
+		}
+	})
+
+	t.Run("traces streams", func(t *testing.T) {
+		tracing, exporter := newTestTracing(t)
+
+		client, mockServer, cleanup := setupTestStreamServer(t, tracing.StreamInterceptor())
+		defer cleanup()
+
+		var handlerContext context.Context
+		mockServer.On("Stream", mock.Anything).Run(func(args mock.Arguments) {
+			handlerContext = args.Get(0).(internal.TestService_StreamServer).Context()
+		}).Return(nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", testTraceparent)
+		stream, err := client.Stream(ctx)
+		assert.Nil(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, io.EOF, err)
+
+		assert.Eventually(t, func() bool {
+			return len(exporter.GetSpans()) == 1
+		}, 5*time.Second, 10*time.Millisecond)
+
+		span := exporter.GetSpans()[0]
+		assert.Equal(t, "internal.TestService/Stream", span.Name)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+		assert.Equal(t, span.SpanContext.SpanID(), trace.SpanContextFromContext(handlerContext).SpanID())
+	})
+
+	t.Run("links metrics exemplars to the span of the server", func(t *testing.T) {
+		tracing, exporter := newTestTracing(t)
+		metrics, err := NewMetrics()
+		assert.Nil(t, err)
+
+		mockServer, cc, cleanup := startTestServer(t, WithTracing(tracing), WithMetrics(metrics))
+		defer cleanup()
+
+		mockServer.On("Endpoint", mock.Anything, mock.Anything).Return(&internal.Output{Value: "World"}, nil)
+
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "traceparent", testTraceparent)
+		_, err = internal.NewTestServiceClient(cc).Endpoint(ctx, &internal.Input{Value: "Hello"}, grpc.WaitForReady(true))
+		assert.Nil(t, err)
+
+		spans := exporter.GetSpans()
+		if !assert.Len(t, spans, 1) {
+			return
+		}
+
+		assert.Equal(t, "127.0.0.1", spanAttribute(spans[0], "network.peer.address").AsString())
+		assert.NotZero(t, spanAttribute(spans[0], "network.peer.port").AsInt64())
+
+		h := histogram(t, metrics.Collectors(), "grpc_request_duration_seconds", prometheus.Labels{"method": "Endpoint"})
+		assert.Equal(t, map[string]string{
+			"trace_id": spans[0].SpanContext.TraceID().String(),
+			"span_id":  spans[0].SpanContext.SpanID().String(),
+		}, exemplarLabels(histogramExemplar(h)))
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := NewTracing(WithTracerProvider(nil))
+		assert.NotNil(t, err)
+
+		_, err = NewTracing(WithPropagator(nil))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithTracing(nil))
+		assert.NotNil(t, err)
+	})
+}
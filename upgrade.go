@@ -0,0 +1,235 @@
+package grpc_server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// upgradeListenFdEnv holds the address of the server whose listener
+	// is handed over to the new process, and its file descriptor, as address=fd
+	upgradeListenFdEnv = "GRPC_SERVER_LISTEN_FD"
+	// upgradeReadyFdEnv holds the file descriptor the new process writes to
+	// once it is serving requests
+	upgradeReadyFdEnv = "GRPC_SERVER_READY_FD"
+)
+
+// ErrUpgradeNotSupported is returned by Upgrade when the listener
+// cannot be handed over to another process.
+var ErrUpgradeNotSupported = errors.New("gRPC server listener does not support upgrades")
+
+// WithUpgradeCommand sets the command started by Upgrade.
+// The default is the command line of the current process.
+func WithUpgradeCommand(path string, args ...string) Option {
+	return func(c *serverConfig) error {
+		if path == "" {
+			return errors.New("upgrade command must not be empty")
+		}
+		c.upgradeCommand = append([]string{path}, args...)
+		return nil
+	}
+}
+
+// WithUpgradeTimeout sets how long Upgrade waits for the new process
+// to start serving requests. The default is one minute.
+func WithUpgradeTimeout(timeout time.Duration) Option {
+	return func(c *serverConfig) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid upgrade timeout %s", timeout)
+		}
+		c.upgradeTimeout = timeout
+		return nil
+	}
+}
+
+// WithUpgradeSignal makes Run upgrade the server when the process
+// receives one of the given signals, e.g. syscall.SIGHUP.
+func WithUpgradeSignal(signals ...os.Signal) Option {
+	return func(c *serverConfig) error {
+		c.upgradeSignals = append(c.upgradeSignals, signals...)
+		return nil
+	}
+}
+
+func (l *listener) Upgrade() error {
+	if err := l.handoff(); err != nil {
+		return err
+	}
+
+	// the new process serves on the same socket: the health status and the
+	// pre-stop delay would only send some of the new connections to a stopping server
+	return l.shutdown(false)
+}
+
+// handoff starts the new process, passing it the listener,
+// and waits until it is serving requests.
+func (l *listener) handoff() error {
+	l.upgradeMu.Lock()
+	defer l.upgradeMu.Unlock()
+
+	l.mu.Lock()
+	started := l.done != nil
+	grpcListener := l.listener
+	l.mu.Unlock()
+
+	if !started {
+		return ErrServerNotStarted
+	}
+
+	if _, ok := grpcListener.(interface{ File() (*os.File, error) }); !ok {
+		return ErrUpgradeNotSupported
+	}
+
+	listenerFile, err := dupListener(grpcListener)
+	if err != nil {
+		return fmt.Errorf("failed to get listener file: %w", err)
+	}
+	defer listenerFile.Close()
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("failed to create readiness pipe: %w", err)
+	}
+	defer readyReader.Close()
+
+	cmd := exec.Command(l.upgradeCommand[0], l.upgradeCommand[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// extra files are numbered from 3 in the new process
+	cmd.ExtraFiles = []*os.File{listenerFile, readyWriter}
+	cmd.Env = append(
+		upgradeEnviron(),
+		upgradeListenFdEnv+"="+l.address+"=3",
+		upgradeReadyFdEnv+"=4",
+	)
+
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return fmt.Errorf("failed to start new process: %w", err)
+	}
+
+	l.logf(LevelInfo, "started new gRPC server process %d, waiting until it is ready...", cmd.Process.Pid)
+
+	ready := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		_, err := readyReader.Read(buf)
+		ready <- err
+	}()
+
+	timer := time.NewTimer(l.upgradeTimeout)
+	defer timer.Stop()
+
+	select {
+	case err = <-ready:
+		if err != nil {
+			err = fmt.Errorf("new process exited before it was ready: %w", err)
+		}
+	case <-timer.C:
+		err = fmt.Errorf("new process was not ready after %s", l.upgradeTimeout)
+	}
+
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return err
+	}
+
+	// reap the new process if it exits before this one
+	go func() {
+		_ = cmd.Wait()
+	}()
+
+	// the new process serves on the same socket file
+	if unixListener, ok := grpcListener.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+
+	l.logf(LevelInfo, "new gRPC server process %d is ready", cmd.Process.Pid)
+
+	return nil
+}
+
+// upgradeEnviron returns the environment of the current process,
+// without the variables used by a previous upgrade.
+func upgradeEnviron() []string {
+	var env []string
+	for _, v := range os.Environ() {
+		if strings.HasPrefix(v, upgradeListenFdEnv+"=") || strings.HasPrefix(v, upgradeReadyFdEnv+"=") {
+			continue
+		}
+		env = append(env, v)
+	}
+	return env
+}
+
+// inheritedMu prevents two servers from using the same inherited listener.
+var inheritedMu sync.Mutex
+
+// inheritedListener returns the listener handed over by the process that started
+// the current one with Upgrade, and the file used to report that the server is ready.
+// It returns nil if no listener was handed over for the server with the given address.
+func inheritedListener(address string) (net.Listener, *os.File, error) {
+	inheritedMu.Lock()
+	defer inheritedMu.Unlock()
+
+	value, ok := os.LookupEnv(upgradeListenFdEnv)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	// the address can contain "=", e.g. in the path of a Unix socket
+	separator := strings.LastIndex(value, "=")
+	if separator < 0 {
+		return nil, nil, fmt.Errorf("invalid %s: %q", upgradeListenFdEnv, value)
+	}
+	if value[:separator] != address {
+		// the listener belongs to another server of this process
+		return nil, nil, nil
+	}
+
+	listenFd, err := strconv.Atoi(value[separator+1:])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", upgradeListenFdEnv, err)
+	}
+
+	listenerFile := os.NewFile(uintptr(listenFd), "grpc-listener")
+	// the listener uses a duplicate of the file descriptor
+	defer listenerFile.Close()
+
+	readyFd, err := strconv.Atoi(os.Getenv(upgradeReadyFdEnv))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", upgradeReadyFdEnv, err)
+	}
+
+	// closing the file without writing to it tells the previous process
+	// that this one failed to start
+	readyFile := os.NewFile(uintptr(readyFd), "grpc-ready")
+
+	// processes started by this one must not use the same file descriptors
+	os.Unsetenv(upgradeListenFdEnv)
+	os.Unsetenv(upgradeReadyFdEnv)
+
+	inherited, err := net.FileListener(listenerFile)
+	if err != nil {
+		readyFile.Close()
+		return nil, nil, fmt.Errorf("failed to use inherited listener: %w", err)
+	}
+
+	// the socket file is removed when the server stops,
+	// unless the listener is handed over again
+	if unixListener, ok := inherited.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(true)
+	}
+
+	return inherited, readyFile, nil
+}
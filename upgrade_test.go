@@ -0,0 +1,388 @@
+//go:build unix
+
+package grpc_server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthgrpc "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	upgradeHelperEnv    = "GRPC_SERVER_TEST_UPGRADE_HELPER"
+	upgradeHelperDirEnv = "GRPC_SERVER_TEST_UPGRADE_DIR"
+)
+
+// TestUpgradeHelperProcess is the new process started by the upgrade tests.
+// It serves on the inherited listener until the test directory is removed.
+func TestUpgradeHelperProcess(t *testing.T) {
+	var servers []GrpcServer
+
+	switch os.Getenv(upgradeHelperEnv) {
+	case "serve":
+	case "serve-two":
+		// this server starts first, and must not use the listener of the upgraded one
+		server, err := NewServer(WithAddress("unix", upgradeHelperSocket(os.Getenv(upgradeHelperDirEnv))))
+		if err != nil {
+			os.Exit(1)
+		}
+		servers = append(servers, server)
+	case "fail":
+		os.Exit(1)
+	default:
+		return
+	}
+
+	server, err := NewServer(WithAddress("tcp", "127.0.0.1:0"))
+	if err != nil {
+		os.Exit(1)
+	}
+	servers = append(servers, server)
+
+	for _, server := range servers {
+		if err := server.Listen(); err != nil {
+			os.Exit(1)
+		}
+	}
+
+	for {
+		if _, err := os.Stat(os.Getenv(upgradeHelperDirEnv)); err != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, server := range servers {
+		_ = server.Stop()
+	}
+	os.Exit(0)
+}
+
+// upgradeHelperSocket returns the path of the Unix socket of the second server
+// started by the new process.
+func upgradeHelperSocket(dir string) string {
+	return filepath.Join(dir, "other.sock")
+}
+
+// setupUpgradeHelper configures the new process started by the upgrade tests.
+// The new process stops at the end of the test, when the test directory is removed.
+func setupUpgradeHelper(t *testing.T, mode string) Option {
+	return setupUpgradeHelperInDir(t, mode, t.TempDir())
+}
+
+func setupUpgradeHelperInDir(t *testing.T, mode, dir string) Option {
+	t.Setenv(upgradeHelperEnv, mode)
+	t.Setenv(upgradeHelperDirEnv, dir)
+
+	return WithUpgradeCommand(os.Args[0], "-test.run=^TestUpgradeHelperProcess$")
+}
+
+// setupInheritedListener sets the environment of a process started by Upgrade,
+// handing over the file returned by listenerFile for the server with the given address.
+// It returns the end of the readiness pipe read by the previous process.
+func setupInheritedListener(t *testing.T, address string, listenerFile func() *os.File) *os.File {
+	file := listenerFile()
+	defer file.Close()
+
+	readyReader, readyWriter, err := os.Pipe()
+	assert.Nil(t, err)
+	defer readyWriter.Close()
+	t.Cleanup(func() {
+		readyReader.Close()
+	})
+
+	// the new server owns the inherited file descriptors, as in a new process
+	listenFd, err := syscall.Dup(int(file.Fd()))
+	assert.Nil(t, err)
+	readyFd, err := syscall.Dup(int(readyWriter.Fd()))
+	assert.Nil(t, err)
+
+	t.Setenv(upgradeListenFdEnv, fmt.Sprintf("%s=%d", address, listenFd))
+	t.Setenv(upgradeReadyFdEnv, strconv.Itoa(readyFd))
+
+	return readyReader
+}
+
+// healthStatus checks the health of the server on a new connection.
+func healthStatus(addr string) (healthgrpc.HealthCheckResponse_ServingStatus, error) {
+	cc, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return healthgrpc.HealthCheckResponse_UNKNOWN, err
+	}
+	defer cc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := healthgrpc.NewHealthClient(cc).Check(ctx, &healthgrpc.HealthCheckRequest{})
+	if err != nil {
+		return healthgrpc.HealthCheckResponse_UNKNOWN, err
+	}
+	return res.Status, nil
+}
+
+func TestUpgrade(t *testing.T) {
+	t.Run("hands over the listener to the new process", func(t *testing.T) {
+		server, err := NewServer(
+			WithAddress("tcp", "127.0.0.1:0"),
+			setupUpgradeHelper(t, "serve"),
+		)
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		addr := server.Addr().String()
+
+		err = server.Upgrade()
+		assert.Nil(t, err)
+
+		// the current server is stopped, the new process serves on the same address
+		err = server.Wait()
+		assert.Nil(t, err)
+
+		err = checkHealth(addr, insecure.NewCredentials())
+		assert.Nil(t, err)
+	})
+
+	t.Run("keeps reporting that it is serving during the upgrade", func(t *testing.T) {
+		server, err := NewServer(
+			WithAddress("tcp", "127.0.0.1:0"),
+			WithPreStopDelay(time.Minute),
+			setupUpgradeHelper(t, "serve"),
+		)
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		addr := server.Addr().String()
+
+		upgradeErr := make(chan error, 1)
+		go func() {
+			upgradeErr <- server.Upgrade()
+		}()
+
+		// probes reach either process, until the current one stops
+		timeout := time.After(5 * time.Second)
+		for upgrading := true; upgrading; {
+			select {
+			case err := <-upgradeErr:
+				assert.Nil(t, err)
+				upgrading = false
+			case <-timeout:
+				t.Fatal("server waited for the pre-stop delay")
+			default:
+				status, err := healthStatus(addr)
+				assert.Nil(t, err)
+				assert.Equal(t, healthgrpc.HealthCheckResponse_SERVING, status)
+			}
+		}
+
+		status, err := healthStatus(addr)
+		assert.Nil(t, err)
+		assert.Equal(t, healthgrpc.HealthCheckResponse_SERVING, status)
+	})
+
+	t.Run("hands over the listener to the server with the same address", func(t *testing.T) {
+		dir := t.TempDir()
+
+		server, err := NewServer(
+			WithAddress("tcp", "127.0.0.1:0"),
+			setupUpgradeHelperInDir(t, "serve-two", dir),
+		)
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		addr := server.Addr().String()
+
+		err = server.Upgrade()
+		assert.Nil(t, err)
+
+		err = server.Wait()
+		assert.Nil(t, err)
+
+		// each server of the new process serves on its own address
+		err = checkHealth(addr, insecure.NewCredentials())
+		assert.Nil(t, err)
+
+		err = checkHealth("unix://"+upgradeHelperSocket(dir), insecure.NewCredentials())
+		assert.Nil(t, err)
+	})
+
+	t.Run("ignores the listener of another server", func(t *testing.T) {
+		t.Setenv(upgradeListenFdEnv, "127.0.0.1:40051=3")
+
+		inherited, readyFile, err := inheritedListener("127.0.0.1:0")
+		assert.Nil(t, err)
+		assert.Nil(t, inherited)
+		assert.Nil(t, readyFile)
+
+		// the listener is left for the server it belongs to
+		assert.Equal(t, "127.0.0.1:40051=3", os.Getenv(upgradeListenFdEnv))
+	})
+
+	t.Run("removes the inherited Unix socket when stopped", func(t *testing.T) {
+		socket := filepath.Join(t.TempDir(), "grpc.sock")
+		setupInheritedListener(t, socket, func() *os.File {
+			unixListener, err := net.ListenUnix("unix", &net.UnixAddr{Name: socket, Net: "unix"})
+			assert.Nil(t, err)
+			defer unixListener.Close()
+
+			// the socket file is left in place for the new server, as after a handoff
+			unixListener.SetUnlinkOnClose(false)
+
+			listenerFile, err := unixListener.File()
+			assert.Nil(t, err)
+			return listenerFile
+		})
+
+		server, err := NewServer(WithAddress("unix", socket))
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+
+		err = checkHealth("unix://"+socket, insecure.NewCredentials())
+		assert.Nil(t, err)
+
+		err = server.Stop()
+		assert.Nil(t, err)
+
+		_, err = os.Stat(socket)
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("reports inherited listener failures to the previous process", func(t *testing.T) {
+		readyReader := setupInheritedListener(t, "127.0.0.1:0", func() *os.File {
+			file, err := os.CreateTemp(t.TempDir(), "not-a-socket")
+			assert.Nil(t, err)
+			return file
+		})
+
+		_, _, err := inheritedListener("127.0.0.1:0")
+		assert.NotNil(t, err)
+
+		// the ready file is closed without reporting that the server is ready
+		_, err = readyReader.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("keeps serving when the new process fails", func(t *testing.T) {
+		server, err := NewServer(
+			WithAddress("tcp", "127.0.0.1:0"),
+			setupUpgradeHelper(t, "fail"),
+		)
+		assert.Nil(t, err)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		err = server.Upgrade()
+		assert.NotNil(t, err)
+
+		err = checkHealth(server.Addr().String(), insecure.NewCredentials())
+		assert.Nil(t, err)
+	})
+
+	t.Run("upgrades on signal", func(t *testing.T) {
+		server, err := NewServer(
+			WithAddress("tcp", "127.0.0.1:0"),
+			WithUpgradeSignal(syscall.SIGHUP),
+			setupUpgradeHelper(t, "serve"),
+		)
+		assert.Nil(t, err)
+
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- server.Run(context.Background())
+		}()
+
+		assert.Eventually(t, func() bool {
+			return server.Addr() != nil
+		}, 5*time.Second, 10*time.Millisecond)
+		addr := server.Addr().String()
+
+		err = syscall.Kill(os.Getpid(), syscall.SIGHUP)
+		assert.Nil(t, err)
+
+		select {
+		case err := <-runErr:
+			assert.Nil(t, err)
+		case <-time.After(time.Minute):
+			t.Fatal("server was not upgraded")
+		}
+
+		err = checkHealth(addr, insecure.NewCredentials())
+		assert.Nil(t, err)
+	})
+
+	t.Run("requires a listener that can be handed over", func(t *testing.T) {
+		tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		server, err := NewServer(WithListener(struct{ net.Listener }{tcpListener}))
+		assert.Nil(t, err)
+
+		err = server.Upgrade()
+		assert.ErrorIs(t, err, ErrServerNotStarted)
+
+		err = server.Listen()
+		assert.Nil(t, err)
+		defer server.Stop()
+
+		err = server.Upgrade()
+		assert.ErrorIs(t, err, ErrUpgradeNotSupported)
+	})
+
+	t.Run("rejects invalid options", func(t *testing.T) {
+		_, err := NewServer(WithUpgradeCommand(""))
+		assert.NotNil(t, err)
+
+		_, err = NewServer(WithUpgradeTimeout(0))
+		assert.NotNil(t, err)
+	})
+}
+
+func TestDupListener(t *testing.T) {
+	t.Run("keeps the listener in non-blocking mode", func(t *testing.T) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.Nil(t, err)
+
+		file, err := dupListener(lis)
+		assert.Nil(t, err)
+		defer file.Close()
+
+		// starting a process with the file gets its descriptor
+		file.Fd()
+
+		accepted := make(chan error, 1)
+		go func() {
+			_, err := lis.Accept()
+			accepted <- err
+		}()
+
+		// in blocking mode, closing waits for the accept to return
+		time.Sleep(50 * time.Millisecond)
+		go lis.Close()
+
+		select {
+		case err := <-accepted:
+			assert.ErrorIs(t, err, net.ErrClosed)
+		case <-time.After(5 * time.Second):
+			t.Fatal("accept did not return after the listener was closed")
+		}
+	})
+}
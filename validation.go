@@ -2,8 +2,8 @@ package grpc_server
 
 import (
 	"context"
+	"fmt"
 
-	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -15,19 +15,53 @@ func ValidationInterceptor(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (resp interface{}, err error) {
+	if err := validate(ctx, req, info.FullMethod); err != nil {
+		return nil, err
+	}
+
+	return handler(ctx, req)
+}
+
+// ValidationStreamInterceptor validates every message received on a stream.
+//
+// When a message does not pass validation, RecvMsg returns an InvalidArgument
+// error to the stream handler.
+func ValidationStreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	return handler(srv, &validatingServerStream{ServerStream: ss, method: info.FullMethod})
+}
+
+type validatingServerStream struct {
+	grpc.ServerStream
+	method string
+}
+
+func (s *validatingServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return validate(s.Context(), m, s.method)
+}
+
+func validate(ctx context.Context, req interface{}, method string) error {
 	if v, ok := req.(interface{ Validate(bool) error }); ok {
 		validationError := v.Validate(false)
 
 		if validationError != nil {
-			log.
-				WithField("request", req).
-				Errorf("validation failed on %s: %v", info.FullMethod, validationError)
+			LoggerFromContext(ctx).Log(ctx, LevelError, fmt.Sprintf("validation failed on %s: %v", method, validationError), Fields{
+				"request": redactorFromContext(ctx).Redact(req),
+			})
 
 			st := status.Convert(validationError)
 
-			return nil, status.New(codes.InvalidArgument, st.Message()).Err()
+			return status.New(codes.InvalidArgument, st.Message()).Err()
 		}
 	}
 
-	return handler(ctx, req)
+	return nil
 }
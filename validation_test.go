@@ -39,4 +39,34 @@ func TestValidation(t *testing.T) {
 		assert.Nil(t, err)
 		assert.Equal(t, "World", res.Value)
 	})
+
+	t.Run("validates every message received on a stream", func(t *testing.T) {
+		client, mockServer, cleanup := setupTestStreamServer(t, ValidationStreamInterceptor)
+		defer cleanup()
+
+		ctx := context.Background()
+
+		mockServer.On("Stream", mock.Anything).Return(echoStream)
+
+		stream, err := client.Stream(ctx)
+		assert.Nil(t, err)
+
+		err = stream.Send(&internal.Input{Value: "Helloooo"})
+		assert.Nil(t, err)
+
+		res, err := stream.Recv()
+		assert.Nil(t, err)
+		assert.Equal(t, "Helloooo", res.Value)
+
+		err = stream.Send(&internal.Input{Value: "Hel"})
+		assert.Nil(t, err)
+
+		_, err = stream.Recv()
+
+		assert.NotNil(t, err)
+		grpcErr, ok := err.(GRPCStatus)
+		assert.True(t, ok)
+		assert.Equal(t, "value is too short", grpcErr.GRPCStatus().Message())
+		assert.Equal(t, codes.InvalidArgument, grpcErr.GRPCStatus().Code())
+	})
 }